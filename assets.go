@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +11,13 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+// localThumbnailKeyFromURL returns the path below assetsRoot that a
+// thumbnail_url written before thumbnails moved to the bucket points at.
+func localThumbnailKeyFromURL(thumbnailURL string) (string, bool) {
+	_, key, found := strings.Cut(thumbnailURL, "/assets/")
+	if !found || key == "" {
+		return "", false
+	}
+	return key, true
+}
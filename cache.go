@@ -1,10 +1,164 @@
 package main
 
-import "net/http"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
 
-func noCacheMiddleware(next http.Handler) http.Handler {
+// immutableCacheControl is used for media. Object keys and asset names
+// contain a content hash or random part and are never reused, so a cached
+// copy can't go stale.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// cachePolicy describes how clients and shared caches may keep a route's
+// successful responses. Errors are never cached.
+type cachePolicy struct {
+	cacheControl string
+	// etag buffers 200 responses, tags them and answers a matching
+	// If-None-Match with 304 Not Modified. The tag is the one the handler
+	// set, which must change whenever the body would, or else a hash of the
+	// body.
+	etag bool
+}
+
+var (
+	cacheImmutable = cachePolicy{cacheControl: immutableCacheControl}
+	// cacheRevalidate lets clients keep a response but check it with the
+	// ETag before each use.
+	cacheRevalidate = cachePolicy{cacheControl: "private, no-cache", etag: true}
+	// cacheNoStore is for authenticated, user-specific responses.
+	cacheNoStore = cachePolicy{cacheControl: "no-store"}
+)
+
+func cacheMiddleware(policy cachePolicy, next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Cache-Control", "no-store")
-		next.ServeHTTP(w, r)
+		if !policy.etag || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(&cacheResponseWriter{ResponseWriter: w, policy: policy}, r)
+			return
+		}
+
+		// What the handler returns depends on who is asking.
+		w.Header().Add("Vary", "Authorization")
+		buffered := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		for name, values := range buffered.header {
+			w.Header()[name] = values
+		}
+		if buffered.status != http.StatusOK {
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(buffered.status)
+			w.Write(buffered.body.Bytes())
+			return
+		}
+
+		etag := buffered.header.Get("ETag")
+		if etag == "" {
+			sum := sha256.Sum256(buffered.body.Bytes())
+			etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Cache-Control", policy.cacheControl)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Length")
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(buffered.body.Bytes())
+		}
 	})
 }
+
+// etagMatches applies the weak comparison If-None-Match calls for.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// versionETagMatches applies If-Match to a resource whose version is
+// tagged versionETag. Tags that add more after a "." still match, such as
+// the viewer handlerVideoGet tags its responses with. Weak tags never match.
+func versionETagMatches(ifMatch, versionETag string) bool {
+	if strings.TrimSpace(ifMatch) == "*" {
+		return true
+	}
+	version := strings.Trim(versionETag, `"`)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !strings.HasPrefix(candidate, `"`) || !strings.HasSuffix(candidate, `"`) {
+			continue
+		}
+		candidate, _, _ = strings.Cut(strings.Trim(candidate, `"`), ".")
+		if candidate == version {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheResponseWriter sets Cache-Control once the status is known, so only
+// successful and not-modified responses carry the route's policy. Handlers
+// can still set a stricter one themselves.
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	policy      cachePolicy
+	wroteHeader bool
+}
+
+func (w *cacheResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status >= 400 {
+			w.Header().Set("Cache-Control", "no-store")
+		} else if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", w.policy.cacheControl)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type bufferedResponseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
+)
+
+// invalidateCDN queues CloudFront invalidations for changed or deleted
+// objects in the bucket.
+func (cfg *apiConfig) invalidateCDN(keys ...string) {
+	paths := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			paths = append(paths, "/"+key)
+		}
+	}
+	cfg.cdnInvalidations.Enqueue(paths...)
+}
+
+func (cfg *apiConfig) handlerInvalidationsList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		QueuedPaths int                `json:"queued_paths"`
+		Pending     []cdn.Invalidation `json:"pending"`
+	}
+
+	if cfg.platform != "dev" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Invalidation status is only available in dev environment."))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		QueuedPaths: cfg.cdnInvalidations.Queued(),
+		Pending:     cfg.cdnInvalidations.Pending(),
+	})
+}
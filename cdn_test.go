@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandlerInvalidationsList(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/thumbnail_upload/" + video.ID.String()
+
+	// Replacing the thumbnail deletes the old object, which queues its path.
+	expectStatus(t, s.upload(path, token, "thumbnail", "image/png", []byte("first"), nil), http.StatusOK)
+	expectStatus(t, s.upload(path, token, "thumbnail", "image/png", []byte("second"), nil), http.StatusOK)
+
+	rec := s.do("GET", "/admin/invalidations", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[struct {
+		QueuedPaths int `json:"queued_paths"`
+	}](t, rec); got.QueuedPaths != 1 {
+		t.Errorf("queued_paths = %d, want 1", got.QueuedPaths)
+	}
+
+	s.cfg.platform = "prod"
+	expectStatus(t, s.do("GET", "/admin/invalidations", "", nil), http.StatusForbidden)
+}
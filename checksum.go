@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"net/http"
+)
+
+const (
+	checksumHeaderSHA256 = "X-Checksum-SHA256"
+	checksumHeaderCRC32C = "X-Checksum-CRC32C"
+)
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// uploadChecksum verifies the bytes a client sent against the checksum it
+// declared for them. Values are base64 like S3's x-amz-checksum-* headers;
+// hex is accepted as well.
+type uploadChecksum struct {
+	algorithm string
+	expected  []byte
+	hash.Hash
+}
+
+func parseUploadChecksum(headers http.Header) (*uploadChecksum, error) {
+	if value := headers.Get(checksumHeaderSHA256); value != "" {
+		expected, err := decodeChecksum(value, sha256.Size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", checksumHeaderSHA256, err)
+		}
+		return &uploadChecksum{algorithm: "SHA256", expected: expected, Hash: sha256.New()}, nil
+	}
+	if value := headers.Get(checksumHeaderCRC32C); value != "" {
+		expected, err := decodeChecksum(value, crc32.Size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", checksumHeaderCRC32C, err)
+		}
+		return &uploadChecksum{algorithm: "CRC32C", expected: expected, Hash: crc32.New(crc32.MakeTable(crc32.Castagnoli))}, nil
+	}
+	return nil, nil
+}
+
+func decodeChecksum(value string, size int) ([]byte, error) {
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+	if decoded, err := hex.DecodeString(value); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("expected %d bytes encoded as base64 or hex", size)
+}
+
+func (c *uploadChecksum) verify() error {
+	actual := c.Sum(nil)
+	if !bytes.Equal(actual, c.expected) {
+		return fmt.Errorf("%w: %s expected %s, got %s", errChecksumMismatch, c.algorithm,
+			base64.StdEncoding.EncodeToString(c.expected), base64.StdEncoding.EncodeToString(actual))
+	}
+	return nil
+}
+
+// sha256HexToBase64 converts the hex digests used as content hashes into the
+// base64 form S3 expects and returns in checksum headers.
+func sha256HexToBase64(hexDigest string) (string, error) {
+	digest, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(digest), nil
+}
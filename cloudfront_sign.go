@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// cloudFrontBaseURL returns the distribution as an absolute URL, since
+// S3_CF_DISTRO is often configured as a bare domain.
+func (cfg *apiConfig) cloudFrontBaseURL() string {
+	if strings.Contains(cfg.s3CfDistribution, "://") {
+		return strings.TrimSuffix(cfg.s3CfDistribution, "/")
+	}
+	return "https://" + strings.TrimSuffix(cfg.s3CfDistribution, "/")
+}
+
+// hlsPrefixForKey is the directory that holds the segments and playlists of
+// an HLS rendition of the object, e.g. "landscape-abc/" for "landscape-abc.mp4".
+func hlsPrefixForKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "/"
+}
+
+func (cfg *apiConfig) signCloudFrontURL(baseURL, key string) (string, error) {
+	resource := joinPublicURL(baseURL, key)
+	signedURL, err := cfg.cfURLSigner.Sign(resource, time.Now().Add(cfg.cfSignedExpiry))
+	if err != nil {
+		return "", fmt.Errorf("couldn't sign CloudFront URL for %s: %w", key, err)
+	}
+	return signedURL, nil
+}
+
+// viewerID returns the user behind an optional bearer token, or uuid.Nil for
+// anonymous requests and invalid tokens.
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
+
+func canViewVideo(viewerID uuid.UUID, video database.Video) bool {
+	return viewerID != uuid.Nil && viewerID == video.UserID
+}
+
+func (cfg *apiConfig) handlerVideoPlaybackCookies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Resource  string    `json:"resource"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	if cfg.cfCookieSigner == nil {
+		respondWithError(w, http.StatusNotImplemented, "CloudFront signed cookies are not configured", nil)
+		return
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if !canViewVideo(userID, video) {
+		respondWithError(w, http.StatusForbidden, "You can't view this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no uploaded file", nil)
+		return
+	}
+	if video.EncryptionKeyID != nil {
+		respondWithError(w, http.StatusConflict, "Encrypted videos are only served through the stream endpoint", nil)
+		return
+	}
+	key, ok := cfg.objectKeyFromStored(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Video isn't served through CloudFront", nil)
+		return
+	}
+
+	resource := joinPublicURL(cfg.publicURLs.video, hlsPrefixForKey(key)) + "*"
+	expiresAt := time.Now().Add(cfg.cfSignedExpiry).UTC()
+	// A canned policy can't cover a wildcard resource, so the prefix needs a
+	// custom one.
+	cookies, err := cfg.cfCookieSigner.SignWithPolicy(&sign.Policy{
+		Statements: []sign.Statement{{
+			Resource: resource,
+			Condition: sign.Condition{
+				DateLessThan: sign.NewAWSEpochTime(expiresAt),
+			},
+		}},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign cookies", err)
+		return
+	}
+	for _, cookie := range cookies {
+		cookie.Expires = expiresAt
+		http.SetCookie(w, cookie)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Resource:  resource,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func newCloudFrontSigners(keyPairID, privateKeyPath, cookieDomain string) (*sign.URLSigner, *sign.CookieSigner, error) {
+	privateKey, err := sign.LoadPEMPrivKeyFile(privateKeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't load CloudFront private key: %w", err)
+	}
+	urlSigner := sign.NewURLSigner(keyPairID, privateKey)
+	cookieSigner := sign.NewCookieSigner(keyPairID, privateKey, func(o *sign.CookieOptions) {
+		o.Domain = cookieDomain
+		o.Path = "/"
+		o.Secure = true
+	})
+	return urlSigner, cookieSigner, nil
+}
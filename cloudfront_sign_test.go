@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+)
+
+func TestHandlerVideoPlaybackCookies(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String() + "/playback_cookies"
+
+	expectStatus(t, s.do("POST", path, token, nil), http.StatusNotImplemented)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.cfCookieSigner = sign.NewCookieSigner("KTESTKEYPAIR", privateKey)
+
+	expectStatus(t, s.do("POST", path, token, nil), http.StatusNotFound)
+	s.setVideoFile(video.ID, "videos/pilot/landscape.mp4", []byte("video"))
+
+	rec := s.do("POST", path, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	resource := decodeJSON[struct {
+		Resource string `json:"resource"`
+	}](t, rec).Resource
+	if !strings.HasPrefix(resource, testCDN+"/") || !strings.HasSuffix(resource, "*") {
+		t.Errorf("resource = %q, want a wildcard on the CDN", resource)
+	}
+	cookies := map[string]bool{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = true
+	}
+	for _, name := range []string{"CloudFront-Policy", "CloudFront-Signature", "CloudFront-Key-Pair-Id"} {
+		if !cookies[name] {
+			t.Errorf("missing cookie %s", name)
+		}
+	}
+
+	expectStatus(t, s.do("POST", path, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, s.do("POST", path, "", nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// prepareDatabase applies pending migrations when DB_AUTO_MIGRATE allows it
+// and otherwise refuses to run against an outdated schema.
+func (cfg *apiConfig) prepareDatabase(ctx context.Context, db database.Client) error {
+	if !cfg.dbAutoMigrate {
+		return db.CheckMigrations(ctx)
+	}
+	applied, err := db.MigrateUp(ctx)
+	logMigrations("Applied", applied)
+	return err
+}
+
+func logMigrations(verb string, migrations []database.Migration) {
+	for _, m := range migrations {
+		log.Printf("%s migration %04d_%s", verb, m.Version, m.Name)
+	}
+}
+
+// commandMigrate manages the schema: `migrate status`, `migrate up`,
+// `migrate down [-steps n]` and `migrate unlock` to clear a lock left by a
+// crashed process.
+func (cfg *apiConfig) commandMigrate(db database.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate status|up|down|unlock")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Unsupported {
+				applied = "pending, needs a build with -tags sqlite_fts5"
+			}
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			log.Printf("%04d_%s: %s", status.Version, status.Name, applied)
+		}
+		return nil
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		logMigrations("Applied", applied)
+		if err == nil && len(applied) == 0 {
+			log.Print("Schema is up to date")
+		}
+		return err
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		reverted, err := db.MigrateDown(ctx, *steps)
+		logMigrations("Reverted", reverted)
+		return err
+	case "unlock":
+		return db.ForceUnlockMigrations(ctx)
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q, expected status, up, down or unlock", args[0])
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// commandMigrateKeys moves existing videos and thumbnails to the layout of
+// the configured key templates and rewrites the videos table to match. Rows
+// that still hold full URLs are rewritten to bare keys on the way.
+func (cfg *apiConfig) commandMigrateKeys(args []string) error {
+	flags := flag.NewFlagSet("migrate-keys", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the planned moves without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	videos, err := cfg.store.GetAllVideos(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get videos: %w", err)
+	}
+	versions, err := cfg.store.GetAllVideoVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get video versions: %w", err)
+	}
+
+	var failures []error
+	moved := 0
+
+	moves, errs := cfg.planVideoKeyMoves(videos, versions)
+	failures = append(failures, errs...)
+	thumbnailMoves, errs := cfg.planThumbnailKeyMoves(ctx, videos)
+	failures = append(failures, errs...)
+	for oldKey, newKey := range thumbnailMoves {
+		moves[oldKey] = newKey
+	}
+
+	for oldKey, newKey := range moves {
+		log.Printf("%s -> %s", oldKey, newKey)
+		if *dryRun {
+			continue
+		}
+		if err := cfg.moveObject(ctx, oldKey, newKey); err != nil {
+			failures = append(failures, err)
+			delete(moves, oldKey)
+			continue
+		}
+		moved++
+	}
+
+	rewritten := 0
+	if !*dryRun {
+		// The videos were read before the moves, so only URLs that still
+		// hold what was read are rewritten; anything uploaded since stays.
+		for _, video := range videos {
+			changed := false
+			if newKey, ok := cfg.storedKeyAfterMoves(video.VideoURL, moves); ok {
+				set, err := cfg.store.SetVideoURLIfUnchanged(ctx, video.ID, *video.VideoURL, newKey)
+				if err != nil {
+					failures = append(failures, fmt.Errorf("couldn't update video %s: %w", video.ID, err))
+				} else if !set {
+					log.Printf("video %s got a new video_url meanwhile, leaving it", video.ID)
+				}
+				changed = changed || set
+			}
+			if newKey, ok := cfg.storedKeyAfterMoves(video.ThumbnailURL, moves); ok {
+				set, err := cfg.store.SetThumbnailURLIfUnchanged(ctx, video.ID, *video.ThumbnailURL, newKey)
+				if err != nil {
+					failures = append(failures, fmt.Errorf("couldn't update video %s: %w", video.ID, err))
+				} else if !set {
+					log.Printf("video %s got a new thumbnail_url meanwhile, leaving it", video.ID)
+				}
+				changed = changed || set
+			}
+			if changed {
+				rewritten++
+			}
+		}
+		cfg.cdnInvalidations.Flush(ctx)
+	}
+
+	for _, failure := range failures {
+		log.Printf("FAILED: %v", failure)
+	}
+	log.Printf("moved %d objects, rewrote %d videos, %d failures", moved, rewritten, len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("migrate-keys finished with %d failures", len(failures))
+	}
+	return nil
+}
+
+// planVideoKeyMoves maps each stored video object that doesn't follow the
+// video key template to its new key. Objects shared through deduplication
+// are placed according to the oldest version that refers to them.
+func (cfg *apiConfig) planVideoKeyMoves(videos []database.Video, versions []database.VideoVersion) (map[string]string, []error) {
+	videoByID := map[uuid.UUID]database.Video{}
+	for _, video := range videos {
+		videoByID[video.ID] = video
+	}
+
+	moves := map[string]string{}
+	seen := map[string]bool{}
+	var failures []error
+	plan := func(oldKey string, video database.Video, variant, checksum string) {
+		if seen[oldKey] {
+			return
+		}
+		seen[oldKey] = true
+		if cfg.videoKeyTemplate.matches(oldKey) {
+			return
+		}
+
+		vars := keyVars{
+			UserID:  video.UserID,
+			VideoID: video.ID,
+			Variant: variant,
+			Ext:     strings.TrimPrefix(path.Ext(oldKey), "."),
+		}
+		if cfg.videoKeyTemplate.uses("{hash}") {
+			digest, err := base64.StdEncoding.DecodeString(checksum)
+			if err != nil || len(digest) != sha256.Size {
+				failures = append(failures, fmt.Errorf("object %s has no recorded SHA-256, can't place it by hash", oldKey))
+				return
+			}
+			vars.Hash = hex.EncodeToString(digest)
+		}
+		newKey, err := cfg.videoKeyTemplate.render(vars)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("couldn't build new key for %s: %w", oldKey, err))
+			return
+		}
+		moves[oldKey] = newKey
+	}
+
+	for _, version := range versions {
+		video, ok := videoByID[version.VideoID]
+		if !ok {
+			continue
+		}
+		plan(version.ObjectKey, video, version.AspectRatio, version.ChecksumSHA256)
+	}
+	// Videos uploaded before versions were recorded only have their URL.
+	for _, video := range videos {
+		if video.VideoURL == nil {
+			continue
+		}
+		key, ok := cfg.objectKeyFromStored(*video.VideoURL)
+		if !ok {
+			continue
+		}
+		checksum := ""
+		if video.VideoChecksumSHA256 != nil {
+			checksum = *video.VideoChecksumSHA256
+		}
+		plan(key, video, legacyVariantFromKey(key), checksum)
+	}
+	return moves, failures
+}
+
+// legacyVariantFromKey reads the orientation out of keys written as
+// "<landscape|portrait|other>-<random>.mp4".
+func legacyVariantFromKey(key string) string {
+	variant, _, found := strings.Cut(path.Base(key), "-")
+	if found && (variant == "landscape" || variant == "portrait") {
+		return variant
+	}
+	return "other"
+}
+
+func (cfg *apiConfig) moveObject(ctx context.Context, oldKey, newKey string) error {
+	copySource := (&url.URL{Path: cfg.s3Bucket + "/" + oldKey}).EscapedPath()
+	_, err := cfg.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &cfg.s3Bucket,
+		Key:        &newKey,
+		CopySource: &copySource,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't copy %s to %s: %w", oldKey, newKey, err)
+	}
+	if err := cfg.store.RenameObjectKey(ctx, oldKey, newKey); err != nil {
+		return fmt.Errorf("couldn't record new key for %s: %w", oldKey, err)
+	}
+	if err := cfg.deleteObject(ctx, oldKey); err != nil {
+		log.Printf("Copied %s but couldn't delete the original: %v", oldKey, err)
+	}
+	return nil
+}
+
+// planThumbnailKeyMoves does the same for thumbnails in the bucket. Local
+// thumbnails are left to migrate-thumbnails, which uploads them straight to
+// the current layout.
+func (cfg *apiConfig) planThumbnailKeyMoves(ctx context.Context, videos []database.Video) (map[string]string, []error) {
+	moves := map[string]string{}
+	seen := map[string]bool{}
+	var failures []error
+	for _, video := range videos {
+		if video.ThumbnailURL == nil {
+			continue
+		}
+		oldKey, ok := cfg.objectKeyFromStored(*video.ThumbnailURL)
+		if !ok || seen[oldKey] {
+			continue
+		}
+		seen[oldKey] = true
+		if cfg.thumbnailKeyTemplate.matches(oldKey) {
+			continue
+		}
+
+		vars := keyVars{
+			UserID:  video.UserID,
+			VideoID: video.ID,
+			Variant: "thumbnail",
+			Ext:     strings.TrimPrefix(path.Ext(oldKey), "."),
+		}
+		if cfg.thumbnailKeyTemplate.uses("{hash}") {
+			obj, err := cfg.store.GetContentObjectByKey(ctx, oldKey)
+			if err != nil || obj.Hash == "" {
+				failures = append(failures, fmt.Errorf("object %s has no recorded SHA-256, can't place it by hash", oldKey))
+				continue
+			}
+			vars.Hash = obj.Hash
+		}
+		newKey, err := cfg.thumbnailKeyTemplate.render(vars)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("couldn't build new key for %s: %w", oldKey, err))
+			continue
+		}
+		moves[oldKey] = newKey
+	}
+	return moves, failures
+}
+
+// storedKeyAfterMoves returns the key to store in a video_url or
+// thumbnail_url when its object was moved or the row still holds a full URL
+// from before keys were stored.
+func (cfg *apiConfig) storedKeyAfterMoves(stored *string, moves map[string]string) (string, bool) {
+	if stored == nil {
+		return "", false
+	}
+	key, ok := cfg.objectKeyFromStored(*stored)
+	if !ok {
+		return "", false
+	}
+	if newKey, moved := moves[key]; moved {
+		return newKey, true
+	}
+	return key, key != *stored
+}
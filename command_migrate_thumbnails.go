@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// commandMigrateThumbnails uploads the thumbnails stored under assetsRoot to
+// the bucket and points the videos that use them at the uploaded objects.
+func (cfg *apiConfig) commandMigrateThumbnails(args []string) error {
+	flags := flag.NewFlagSet("migrate-thumbnails", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the planned uploads without changing anything")
+	deleteLocal := flags.Bool("delete", false, "remove local files once every video using them is updated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	videos, err := cfg.store.GetAllVideos(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get videos: %w", err)
+	}
+	videosByThumbnail := map[string][]database.Video{}
+	for _, video := range videos {
+		if video.ThumbnailURL == nil {
+			continue
+		}
+		if _, ok := cfg.objectKeyFromStored(*video.ThumbnailURL); ok {
+			continue
+		}
+		localKey, ok := localThumbnailKeyFromURL(*video.ThumbnailURL)
+		if !ok {
+			continue
+		}
+		videosByThumbnail[localKey] = append(videosByThumbnail[localKey], video)
+	}
+
+	var failures []error
+	uploaded, rewritten, skipped := 0, 0, 0
+	err = filepath.WalkDir(cfg.assetsRoot, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			failures = append(failures, err)
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.assetsRoot, filePath)
+		if err != nil {
+			failures = append(failures, err)
+			return nil
+		}
+		localKey := filepath.ToSlash(rel)
+		referrers := videosByThumbnail[localKey]
+		delete(videosByThumbnail, localKey)
+		if len(referrers) == 0 {
+			log.Printf("skipping %s, no video uses it", localKey)
+			skipped++
+			return nil
+		}
+
+		obj, err := cfg.uploadLocalThumbnail(ctx, filePath, localKey, referrers, *dryRun)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("couldn't upload %s: %w", localKey, err))
+			return nil
+		}
+		if *dryRun {
+			return nil
+		}
+		uploaded++
+
+		updated := 0
+		for _, video := range referrers {
+			set, err := cfg.store.SetThumbnailURLIfUnchanged(ctx, video.ID, *video.ThumbnailURL, obj.ObjectKey)
+			if err != nil {
+				failures = append(failures, fmt.Errorf("couldn't update video %s: %w", video.ID, err))
+				continue
+			}
+			if !set {
+				// A new thumbnail was uploaded meanwhile; drop the reference
+				// taken for this video.
+				log.Printf("video %s got a new thumbnail meanwhile, leaving it", video.ID)
+				if err := cfg.releaseObject(ctx, obj.ObjectKey); err != nil {
+					failures = append(failures, fmt.Errorf("couldn't release %s: %w", obj.ObjectKey, err))
+				}
+				continue
+			}
+			// Thumbnails in the bucket count towards the owner's storage.
+			if err := cfg.store.AddUserStorageUsage(ctx, video.UserID, obj.SizeBytes); err != nil {
+				failures = append(failures, fmt.Errorf("couldn't count thumbnail of video %s: %w", video.ID, err))
+			}
+			updated++
+		}
+		rewritten += updated
+		if *deleteLocal && updated == len(referrers) {
+			if err := os.Remove(filePath); err != nil {
+				failures = append(failures, fmt.Errorf("couldn't remove %s: %w", filePath, err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't walk %s: %w", cfg.assetsRoot, err)
+	}
+
+	for localKey, referrers := range videosByThumbnail {
+		for _, video := range referrers {
+			failures = append(failures, fmt.Errorf("video %s points at %s, which is missing from %s", video.ID, localKey, cfg.assetsRoot))
+		}
+	}
+
+	for _, failure := range failures {
+		log.Printf("FAILED: %v", failure)
+	}
+	log.Printf("uploaded %d thumbnails, rewrote %d videos, skipped %d unused files, %d failures", uploaded, rewritten, skipped, len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("migrate-thumbnails finished with %d failures", len(failures))
+	}
+	return nil
+}
+
+// uploadLocalThumbnail stores the file under the key the thumbnail template
+// gives the first video using it, with one reference per video.
+func (cfg *apiConfig) uploadLocalThumbnail(ctx context.Context, filePath, localKey string, referrers []database.Video, dryRun bool) (database.ContentObject, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	defer file.Close()
+
+	hash, size, err := hashFile(file)
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	ext := strings.TrimPrefix(path.Ext(localKey), ".")
+	contentType := mime.TypeByExtension(path.Ext(localKey))
+	if contentType == "" {
+		header := make([]byte, 512)
+		n, _ := file.Read(header)
+		contentType = http.DetectContentType(header[:n])
+	}
+	key, err := cfg.thumbnailKeyTemplate.render(keyVars{
+		UserID:  referrers[0].UserID,
+		VideoID: referrers[0].ID,
+		Variant: "thumbnail",
+		Ext:     ext,
+		Hash:    hash,
+	})
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	log.Printf("%s -> %s (%d videos)", localKey, key, len(referrers))
+	if dryRun {
+		return database.ContentObject{}, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return database.ContentObject{}, err
+	}
+	owner := cfg.thumbnailKeyTemplate.dedupOwner(referrers[0].UserID)
+	obj, err := cfg.storeObject(ctx, file, hash, size, key, contentType, owner, false)
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	for range referrers[1:] {
+		if _, err := cfg.store.AcquireContentObject(ctx, hash, owner); err != nil {
+			return database.ContentObject{}, err
+		}
+	}
+	return obj, nil
+}
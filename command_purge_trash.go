@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// commandPurgeTrash runs the trash purge the server otherwise runs every
+// TRASH_PURGE_INTERVAL, permanently deleting videos that have been in the
+// trash for longer than TRASH_RETENTION.
+func (cfg *apiConfig) commandPurgeTrash(args []string) error {
+	flags := flag.NewFlagSet("purge-trash", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the videos that would be purged without deleting anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if *dryRun {
+		cutoff := time.Now().Add(-cfg.trashRetention)
+		var after *database.Video
+		for {
+			videos, err := cfg.store.ListVideosTrashedBefore(ctx, cutoff, after, trashPurgeBatchSize)
+			if err != nil {
+				return fmt.Errorf("couldn't get trashed videos: %w", err)
+			}
+			for _, video := range videos {
+				log.Printf("%s: %q, deleted %s", video.ID, video.Title, video.DeletedAt.Format(time.RFC3339))
+			}
+			if len(videos) < trashPurgeBatchSize {
+				return nil
+			}
+			after = &videos[len(videos)-1]
+		}
+	}
+
+	purged, err := cfg.purgeTrash(ctx)
+	cfg.cdnInvalidations.Flush(ctx)
+	log.Printf("purged %d videos from the trash", purged)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+)
+
+// commandRotateKeys re-wraps the data keys of encrypted objects with the
+// active master key. The objects themselves stay as they are, so once this
+// finishes the old master keys can be dropped from MEDIA_ENCRYPTION_KEYS.
+func (cfg *apiConfig) commandRotateKeys(args []string) error {
+	flags := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the objects that would be re-wrapped without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cfg.mediaKeys == nil {
+		return errors.New("MEDIA_ENCRYPTION_KEY_ID must name the key to rotate to")
+	}
+	activeID := cfg.mediaKeys.ActiveID()
+	ctx := context.Background()
+
+	objs, err := cfg.store.GetEncryptedContentObjects(ctx, activeID)
+	if err != nil {
+		return fmt.Errorf("couldn't get encrypted objects: %w", err)
+	}
+
+	var failures []error
+	rewrapped := 0
+	for _, obj := range objs {
+		log.Printf("%s: %s -> %s", obj.ObjectKey, *obj.EncryptionKeyID, activeID)
+		if *dryRun {
+			continue
+		}
+		dataKey, err := cfg.mediaKeys.Unwrap(*obj.EncryptionKeyID, *obj.WrappedDataKey)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", obj.ObjectKey, err))
+			continue
+		}
+		keyID, wrapped, err := cfg.mediaKeys.Wrap(dataKey)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", obj.ObjectKey, err))
+			continue
+		}
+		ok, err := cfg.store.RewrapContentObject(ctx, obj, *obj.EncryptionKeyID, keyID, wrapped)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("couldn't record new data key for %s: %w", obj.ObjectKey, err))
+			continue
+		}
+		if !ok {
+			// Released or rotated by someone else in the meantime.
+			continue
+		}
+		rewrapped++
+	}
+
+	for _, failure := range failures {
+		log.Printf("FAILED: %v", failure)
+	}
+	log.Printf("re-wrapped %d of %d data keys, %d failures", rewrapped, len(objs), len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("rotate-keys finished with %d failures", len(failures))
+	}
+	return nil
+}
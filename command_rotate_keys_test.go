@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/envelope"
+)
+
+// testKeyring holds the named master keys, each derived from its name.
+func testKeyring(t *testing.T, activeID string, ids ...string) *envelope.Keyring {
+	t.Helper()
+
+	var value string
+	for _, id := range ids {
+		key := sha256.Sum256([]byte(id))
+		value += id + ":" + base64.StdEncoding.EncodeToString(key[:]) + ","
+	}
+	keyring, err := envelope.ParseKeyring(value, activeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestCommandRotateKeys(t *testing.T) {
+	installFakeMediaTools(t)
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	video := s.createVideo(token, "Pilot")
+	data := bytes.Repeat([]byte("not really an mp4 "), 5000)
+
+	s.cfg.mediaKeys = testKeyring(t, "old", "old")
+	s.uploadVideo(token, video.ID, data)
+	ctx := context.Background()
+	uploaded, err := s.store.GetVideo(ctx, video.ID)
+	if err != nil || uploaded.EncryptionKeyID == nil || *uploaded.EncryptionKeyID != "old" {
+		t.Fatalf("uploaded video = %+v, %v, want it encrypted with old", uploaded, err)
+	}
+	key := *uploaded.VideoURL
+	before, ok := s.bucket.get(key)
+	if !ok || bytes.Equal(before.data, data) {
+		t.Fatalf("bucket has %d bytes under %s, want the encrypted video", len(before.data), key)
+	}
+
+	s.cfg.mediaKeys = testKeyring(t, "new", "old", "new")
+	if err := s.cfg.commandRotateKeys(nil); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := s.bucket.get(key); !bytes.Equal(after.data, before.data) {
+		t.Error("rotate-keys changed the object in the bucket")
+	}
+	obj, err := s.store.GetContentObjectByKey(ctx, key)
+	if err != nil || obj.EncryptionKeyID == nil || *obj.EncryptionKeyID != "new" {
+		t.Errorf("content object = %+v, %v, want its data key wrapped by new", obj, err)
+	}
+	if rotated, err := s.store.GetVideo(ctx, video.ID); err != nil || *rotated.EncryptionKeyID != "new" {
+		t.Errorf("video = %+v, %v, want it pointed at new", rotated, err)
+	}
+	if err := s.cfg.commandRotateKeys(nil); err != nil {
+		t.Errorf("rotate-keys with nothing left to re-wrap = %v", err)
+	}
+
+	// The old master key can go: the stream decrypts with the new one alone.
+	s.cfg.mediaKeys = testKeyring(t, "new", "new")
+	path := "/api/videos/" + video.ID.String() + "/stream"
+	rec := s.do("GET", path, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !bytes.Equal(rec.Body.Bytes(), data) {
+		t.Errorf("stream returned %d bytes, want the %d uploaded", rec.Body.Len(), len(data))
+	}
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Range", "bytes=70000-70009")
+	rec = s.serve(req)
+	expectStatus(t, rec, http.StatusPartialContent)
+	if !bytes.Equal(rec.Body.Bytes(), data[70000:70010]) {
+		t.Errorf("ranged stream = %q, want %q", rec.Body, data[70000:70010])
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func runCommand(cfg *apiConfig, db database.Client, name string, args []string) error {
+	if name == "migrate" {
+		return cfg.commandMigrate(db, args)
+	}
+	if err := cfg.prepareDatabase(context.Background(), db); err != nil {
+		return err
+	}
+
+	switch name {
+	case "migrate-keys":
+		return cfg.commandMigrateKeys(args)
+	case "migrate-thumbnails":
+		return cfg.commandMigrateThumbnails(args)
+	case "rotate-keys":
+		return cfg.commandRotateKeys(args)
+	case "purge-trash":
+		return cfg.commandPurgeTrash(args)
+	default:
+		return fmt.Errorf("unknown command %q, expected one of: migrate, migrate-keys, migrate-thumbnails, rotate-keys, purge-trash", name)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/envelope"
+)
+
+type apiConfig struct {
+	store                database.Store
+	dbAutoMigrate        bool
+	jwtSecret            string
+	platform             string
+	filepathRoot         string
+	assetsRoot           string
+	s3Bucket             string
+	s3Region             string
+	s3CfDistribution     string
+	publicURLs           publicURLs
+	port                 string
+	s3Client             *s3.Client
+	s3PresignClient      *s3.PresignClient
+	s3PrivateBucket      bool
+	s3PresignExpiry      time.Duration
+	cfURLSigner          *sign.URLSigner
+	cfCookieSigner       *sign.CookieSigner
+	cfSignedExpiry       time.Duration
+	cdnInvalidations     *cdn.Batcher
+	mediaKeys            *envelope.Keyring
+	videoKeyTemplate     keyTemplate
+	thumbnailKeyTemplate keyTemplate
+	videoVersionLimit    int
+	quotaBytes           int64
+	quotaVideos          int
+	trashRetention       time.Duration
+	trashPurgeInterval   time.Duration
+}
+
+// loadConfig reads the configuration from the environment. The handlers only
+// see the database through cfg.store; the Client is returned as well for the
+// commands that manage the schema and rewrite rows in bulk.
+func loadConfig() (apiConfig, database.Client) {
+	// DB_URL is either a postgres:// URL or an SQLite file path; DB_PATH is
+	// still read for older .env files.
+	dbURL := envOrDefault("DB_URL", os.Getenv("DB_PATH"))
+	if dbURL == "" {
+		log.Fatal("DB_URL must be set")
+	}
+
+	dbOptions, err := loadDatabaseOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.NewClient(dbURL, dbOptions)
+	if err != nil {
+		log.Fatalf("Couldn't connect to database: %v", err)
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET environment variable is not set")
+	}
+
+	platform := os.Getenv("PLATFORM")
+	if platform == "" {
+		log.Fatal("PLATFORM environment variable is not set")
+	}
+
+	filepathRoot := os.Getenv("FILEPATH_ROOT")
+	if filepathRoot == "" {
+		log.Fatal("FILEPATH_ROOT environment variable is not set")
+	}
+
+	assetsRoot := os.Getenv("ASSETS_ROOT")
+	if assetsRoot == "" {
+		log.Fatal("ASSETS_ROOT environment variable is not set")
+	}
+
+	s3Bucket := os.Getenv("S3_BUCKET")
+	if s3Bucket == "" {
+		log.Fatal("S3_BUCKET environment variable is not set")
+	}
+
+	s3Region := os.Getenv("S3_REGION")
+	if s3Region == "" {
+		log.Fatal("S3_REGION environment variable is not set")
+	}
+
+	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
+	if s3CfDistribution == "" {
+		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(
+		context.Background(),
+		config.WithRegion(s3Region),
+	)
+	if err != nil {
+		log.Fatalf("Couldn't load AWS config: %v", err)
+	}
+	s3Endpoint := os.Getenv("S3_ENDPOINT")
+	if (os.Getenv("S3_ACCESS_KEY_ID") == "") != (os.Getenv("S3_SECRET_ACCESS_KEY") == "") {
+		log.Fatal("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set together")
+	}
+	s3Client, err := newS3Client(awsCfg, s3ClientOptions{
+		endpoint:           s3Endpoint,
+		usePathStyle:       os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+		accessKeyID:        os.Getenv("S3_ACCESS_KEY_ID"),
+		secretAccessKey:    os.Getenv("S3_SECRET_ACCESS_KEY"),
+		sessionToken:       os.Getenv("S3_SESSION_TOKEN"),
+		caCertPath:         os.Getenv("S3_CA_CERT_PATH"),
+		insecureSkipVerify: os.Getenv("S3_TLS_INSECURE_SKIP_VERIFY") == "true",
+	})
+	if err != nil {
+		log.Fatalf("Couldn't create S3 client: %v", err)
+	}
+	if os.Getenv("S3_STARTUP_PROBE") != "false" {
+		err = probeBucket(context.Background(), s3Client, s3Bucket, s3Endpoint)
+		if err != nil {
+			log.Fatalf("S3 startup check failed: %v", err)
+		}
+	}
+
+	s3PrivateBucket := os.Getenv("S3_PRIVATE_BUCKET") == "true"
+	s3PresignExpiry := 15 * time.Minute
+	if expiry := os.Getenv("S3_PRESIGN_EXPIRY"); expiry != "" {
+		s3PresignExpiry, err = time.ParseDuration(expiry)
+		if err != nil || s3PresignExpiry <= 0 {
+			log.Fatal("S3_PRESIGN_EXPIRY must be a positive duration such as 15m")
+		}
+	}
+
+	var cfURLSigner *sign.URLSigner
+	var cfCookieSigner *sign.CookieSigner
+	if cfKeyPairID := os.Getenv("CF_KEY_PAIR_ID"); cfKeyPairID != "" {
+		cfPrivateKeyPath := os.Getenv("CF_PRIVATE_KEY_PATH")
+		if cfPrivateKeyPath == "" {
+			log.Fatal("CF_PRIVATE_KEY_PATH must be set when CF_KEY_PAIR_ID is set")
+		}
+		cfURLSigner, cfCookieSigner, err = newCloudFrontSigners(cfKeyPairID, cfPrivateKeyPath, os.Getenv("CF_COOKIE_DOMAIN"))
+		if err != nil {
+			log.Fatalf("Couldn't set up CloudFront signing: %v", err)
+		}
+	}
+	cfSignedExpiry := time.Hour
+	if expiry := os.Getenv("CF_SIGNED_EXPIRY"); expiry != "" {
+		cfSignedExpiry, err = time.ParseDuration(expiry)
+		if err != nil || cfSignedExpiry <= 0 {
+			log.Fatal("CF_SIGNED_EXPIRY must be a positive duration such as 1h")
+		}
+	}
+
+	var invalidator cdn.Invalidator = cdn.NewFakeInvalidator()
+	if cfDistributionID := os.Getenv("CF_DISTRIBUTION_ID"); cfDistributionID != "" {
+		invalidator = cdn.NewCloudFrontInvalidator(cloudfront.NewFromConfig(awsCfg), cfDistributionID)
+	}
+	invalidationInterval := 30 * time.Second
+	if interval := os.Getenv("CDN_INVALIDATION_INTERVAL"); interval != "" {
+		invalidationInterval, err = time.ParseDuration(interval)
+		if err != nil || invalidationInterval <= 0 {
+			log.Fatal("CDN_INVALIDATION_INTERVAL must be a positive duration such as 30s")
+		}
+	}
+	cdnInvalidations := cdn.NewBatcher(invalidator, invalidationInterval)
+
+	var mediaKeys *envelope.Keyring
+	if activeKeyID := os.Getenv("MEDIA_ENCRYPTION_KEY_ID"); activeKeyID != "" {
+		mediaKeys, err = envelope.ParseKeyring(os.Getenv("MEDIA_ENCRYPTION_KEYS"), activeKeyID)
+		if err != nil {
+			log.Fatalf("Invalid MEDIA_ENCRYPTION_KEYS: %v", err)
+		}
+	}
+
+	videoKeyTemplate, err := parseKeyTemplate(envOrDefault("VIDEO_KEY_TEMPLATE", defaultVideoKeyTemplate))
+	if err != nil {
+		log.Fatalf("Invalid VIDEO_KEY_TEMPLATE: %v", err)
+	}
+	thumbnailKeyTemplate, err := parseKeyTemplate(envOrDefault("THUMBNAIL_KEY_TEMPLATE", defaultThumbnailKeyTemplate))
+	if err != nil {
+		log.Fatalf("Invalid THUMBNAIL_KEY_TEMPLATE: %v", err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("PORT environment variable is not set")
+	}
+
+	publicURLs, err := loadPublicURLs(s3CfDistribution, port)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	videoVersionLimit := 5
+	if limit := os.Getenv("VIDEO_VERSION_LIMIT"); limit != "" {
+		videoVersionLimit, err = strconv.Atoi(limit)
+		if err != nil || videoVersionLimit < 1 {
+			log.Fatal("VIDEO_VERSION_LIMIT must be a positive integer")
+		}
+	}
+
+	quotaBytes := int64(5 << 30) // 5 GB
+	if quota := os.Getenv("USER_QUOTA_BYTES"); quota != "" {
+		quotaBytes, err = strconv.ParseInt(quota, 10, 64)
+		if err != nil || quotaBytes < 0 {
+			log.Fatal("USER_QUOTA_BYTES must be a non-negative integer")
+		}
+	}
+
+	quotaVideos := 100
+	if quota := os.Getenv("USER_QUOTA_VIDEOS"); quota != "" {
+		quotaVideos, err = strconv.Atoi(quota)
+		if err != nil || quotaVideos < 0 {
+			log.Fatal("USER_QUOTA_VIDEOS must be a non-negative integer")
+		}
+	}
+
+	trashRetention := 30 * 24 * time.Hour
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		trashRetention, err = time.ParseDuration(retention)
+		if err != nil || trashRetention < 0 {
+			log.Fatal("TRASH_RETENTION must be a duration such as 720h, or 0 to purge on the next run")
+		}
+	}
+	trashPurgeInterval := time.Hour
+	if interval := os.Getenv("TRASH_PURGE_INTERVAL"); interval != "" {
+		trashPurgeInterval, err = time.ParseDuration(interval)
+		if err != nil || trashPurgeInterval <= 0 {
+			log.Fatal("TRASH_PURGE_INTERVAL must be a positive duration such as 1h")
+		}
+	}
+
+	cfg := apiConfig{
+		store:                db,
+		dbAutoMigrate:        os.Getenv("DB_AUTO_MIGRATE") != "false",
+		jwtSecret:            jwtSecret,
+		platform:             platform,
+		filepathRoot:         filepathRoot,
+		assetsRoot:           assetsRoot,
+		s3Bucket:             s3Bucket,
+		s3Region:             s3Region,
+		s3CfDistribution:     s3CfDistribution,
+		publicURLs:           publicURLs,
+		port:                 port,
+		s3Client:             s3Client,
+		s3PresignClient:      s3.NewPresignClient(s3Client),
+		s3PrivateBucket:      s3PrivateBucket,
+		s3PresignExpiry:      s3PresignExpiry,
+		cfURLSigner:          cfURLSigner,
+		cfCookieSigner:       cfCookieSigner,
+		cfSignedExpiry:       cfSignedExpiry,
+		cdnInvalidations:     cdnInvalidations,
+		mediaKeys:            mediaKeys,
+		videoKeyTemplate:     videoKeyTemplate,
+		thumbnailKeyTemplate: thumbnailKeyTemplate,
+		videoVersionLimit:    videoVersionLimit,
+		quotaBytes:           quotaBytes,
+		quotaVideos:          quotaVideos,
+		trashRetention:       trashRetention,
+		trashPurgeInterval:   trashPurgeInterval,
+	}
+
+	return cfg, db
+}
+
+// loadPublicURLs reads the base URL of each asset class. Videos default to
+// the CloudFront distribution, thumbnails to wherever videos are served from,
+// and local assets to this server.
+func loadPublicURLs(s3CfDistribution, port string) (publicURLs, error) {
+	video, err := parsePublicBaseURL(envOrDefault("PUBLIC_VIDEO_BASE_URL", s3CfDistribution))
+	if err != nil {
+		return publicURLs{}, fmt.Errorf("invalid PUBLIC_VIDEO_BASE_URL: %w", err)
+	}
+	thumbnail, err := parsePublicBaseURL(envOrDefault("PUBLIC_THUMBNAIL_BASE_URL", video))
+	if err != nil {
+		return publicURLs{}, fmt.Errorf("invalid PUBLIC_THUMBNAIL_BASE_URL: %w", err)
+	}
+	assets, err := parsePublicBaseURL(envOrDefault("PUBLIC_ASSETS_BASE_URL", "http://localhost:"+port+"/assets"))
+	if err != nil {
+		return publicURLs{}, fmt.Errorf("invalid PUBLIC_ASSETS_BASE_URL: %w", err)
+	}
+	return publicURLs{video: video, thumbnail: thumbnail, assets: assets}, nil
+}
+
+// loadDatabaseOptions reads the connection pool and query limits. SQLite
+// defaults to WAL with a busy timeout, so readers don't block the writer and
+// concurrent writers wait instead of failing with "database is locked".
+func loadDatabaseOptions() (database.Options, error) {
+	opts := database.Options{
+		QueryTimeout:      5 * time.Second,
+		SQLiteJournalMode: envOrDefault("DB_SQLITE_JOURNAL_MODE", "WAL"),
+		SQLiteBusyTimeout: 5 * time.Second,
+	}
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"DB_QUERY_TIMEOUT", &opts.QueryTimeout},
+		{"DB_CONN_MAX_LIFETIME", &opts.ConnMaxLifetime},
+		{"DB_CONN_MAX_IDLE_TIME", &opts.ConnMaxIdleTime},
+		{"DB_SQLITE_BUSY_TIMEOUT", &opts.SQLiteBusyTimeout},
+	}
+	for _, d := range durations {
+		if value := os.Getenv(d.name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				return database.Options{}, fmt.Errorf("%s must be a duration such as 5s, or 0 for no limit", d.name)
+			}
+			*d.value = parsed
+		}
+	}
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"DB_MAX_OPEN_CONNS", &opts.MaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", &opts.MaxIdleConns},
+	}
+	for _, n := range ints {
+		if value := os.Getenv(n.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return database.Options{}, fmt.Errorf("%s must be a non-negative integer", n.name)
+			}
+			*n.value = parsed
+		}
+	}
+	return opts, nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
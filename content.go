@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func hashFile(file io.ReadSeeker) (string, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// storeObject uploads file, whose SHA-256 and size come from hashFile,
+// under key unless an object with the same content already exists for owner
+// (see keyTemplate.dedupOwner), in which case that object gains a reference
+// and its key is returned instead. S3
+// verifies the upload against the SHA-256 we computed, so a corrupted
+// transfer fails instead of being stored. With encrypt set, the object is
+// encrypted under a new data key first.
+func (cfg *apiConfig) storeObject(ctx context.Context, file io.ReadSeeker, hash string, size int64, key, contentType string, owner *uuid.UUID, encrypt bool) (database.ContentObject, error) {
+	existing, err := cfg.store.GetContentObject(ctx, hash, owner)
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	if existing.ObjectKey != "" {
+		acquired, err := cfg.store.AcquireContentObject(ctx, hash, owner)
+		if err != nil {
+			return database.ContentObject{}, err
+		}
+		if acquired {
+			return existing, nil
+		}
+	}
+
+	params := database.CreateContentObjectParams{
+		Hash:        hash,
+		ObjectKey:   key,
+		SizeBytes:   size,
+		ContentType: contentType,
+		OwnerID:     owner,
+	}
+	body := file
+	bodyHash := hash
+	bodyContentType := contentType
+	if encrypt {
+		encrypted, keyID, wrapped, err := cfg.encryptToTempFile(file)
+		if err != nil {
+			return database.ContentObject{}, err
+		}
+		defer removeTempFile(encrypted)
+		bodyHash, _, err = hashFile(encrypted)
+		if err != nil {
+			return database.ContentObject{}, err
+		}
+		body = encrypted
+		bodyContentType = "application/octet-stream"
+		params.EncryptionKeyID = &keyID
+		params.WrappedDataKey = &wrapped
+	}
+
+	checksum, err := sha256HexToBase64(bodyHash)
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:         &cfg.s3Bucket,
+		Key:            &key,
+		Body:           body,
+		ContentType:    &bodyContentType,
+		CacheControl:   aws.String(immutableCacheControl),
+		ChecksumSHA256: &checksum,
+	})
+	if err != nil {
+		return database.ContentObject{}, fmt.Errorf("couldn't upload file to S3: %w", err)
+	}
+
+	obj, err := cfg.store.CreateContentObject(ctx, params)
+	if err != nil {
+		return database.ContentObject{}, err
+	}
+	if obj.ObjectKey != key {
+		if err := cfg.deleteObject(ctx, key); err != nil {
+			log.Printf("Couldn't delete duplicate object %s: %v", key, err)
+		}
+	}
+	return obj, nil
+}
+
+// releaseObject drops one reference to key and deletes the object from
+// the bucket once nothing refers to it anymore.
+func (cfg *apiConfig) releaseObject(ctx context.Context, key string) error {
+	remaining, err := cfg.store.ReleaseContentObject(ctx, key)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return nil
+	}
+	return cfg.deleteObject(ctx, key)
+}
+
+func (cfg *apiConfig) deleteObject(ctx context.Context, key string) error {
+	_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't delete object %s: %w", key, err)
+	}
+	cfg.invalidateCDN(key)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/envelope"
+	"github.com/google/uuid"
+)
+
+// encryptsMedia reports whether new videos are encrypted before they are
+// uploaded.
+func (cfg *apiConfig) encryptsMedia() bool {
+	return cfg.mediaKeys != nil
+}
+
+// encryptToTempFile encrypts file under a new data key. It returns the
+// encrypted copy, which the caller removes, and the data key wrapped by the
+// active master key.
+func (cfg *apiConfig) encryptToTempFile(file io.ReadSeeker) (*os.File, string, string, error) {
+	dataKey, err := envelope.NewDataKey()
+	if err != nil {
+		return nil, "", "", err
+	}
+	keyID, wrapped, err := cfg.mediaKeys.Wrap(dataKey)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("couldn't wrap data key: %w", err)
+	}
+
+	encrypted, err := os.CreateTemp("", "tubely-encrypted.bin")
+	if err != nil {
+		return nil, "", "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		removeTempFile(encrypted)
+		return nil, "", "", err
+	}
+	if err := envelope.Encrypt(encrypted, file, dataKey); err != nil {
+		removeTempFile(encrypted)
+		return nil, "", "", fmt.Errorf("couldn't encrypt file: %w", err)
+	}
+	return encrypted, keyID, wrapped, nil
+}
+
+func removeTempFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// restrictsVideo reports whether only users allowed to view a video get its
+// URL. Encrypted videos are always restricted.
+func (cfg *apiConfig) restrictsVideo(video database.Video) bool {
+	return cfg.signsVideoURLs() || video.EncryptionKeyID != nil
+}
+
+// signedStreamURL links to the decrypting stream endpoint. The signature
+// stands in for the bearer token a <video> element can't send.
+func (cfg *apiConfig) signedStreamURL(videoID uuid.UUID) string {
+	expires := strconv.FormatInt(time.Now().Add(cfg.s3PresignExpiry).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {cfg.streamSignature(videoID, expires)},
+	}
+	return fmt.Sprintf("/api/videos/%s/stream?%s", videoID, query.Encode())
+}
+
+func (cfg *apiConfig) streamSignature(videoID uuid.UUID, expires string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	fmt.Fprintf(mac, "stream:%s:%s", videoID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (cfg *apiConfig) validStreamSignature(r *http.Request, videoID uuid.UUID) bool {
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+	if expires == "" || signature == "" {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(cfg.streamSignature(videoID, expires)))
+}
+
+// serveDecryptedObject streams an encrypted object in the clear. Only the
+// chunks covering the requested range are fetched and decrypted, and
+// http.ServeContent answers Range, If-Range and conditional requests using
+// the content hash as ETag.
+func (cfg *apiConfig) serveDecryptedObject(w http.ResponseWriter, r *http.Request, key string) {
+	obj, err := cfg.store.GetContentObjectByKey(r.Context(), key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get object", err)
+		return
+	}
+	if obj.EncryptionKeyID == nil || obj.WrappedDataKey == nil {
+		cfg.proxyObject(w, r, key)
+		return
+	}
+	if cfg.mediaKeys == nil {
+		respondWithError(w, http.StatusInternalServerError, "Media encryption isn't configured", nil)
+		return
+	}
+	dataKey, err := cfg.mediaKeys.Unwrap(*obj.EncryptionKeyID, *obj.WrappedDataKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unwrap data key", err)
+		return
+	}
+
+	reader, err := envelope.NewReader(func(offset int64) (io.ReadCloser, error) {
+		rangeHeader := fmt.Sprintf("bytes=%d-", offset)
+		output, err := cfg.s3Client.GetObject(r.Context(), &s3.GetObjectInput{
+			Bucket: &cfg.s3Bucket,
+			Key:    &key,
+			Range:  &rangeHeader,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get %s: %w", key, err)
+		}
+		return output.Body, nil
+	}, dataKey, obj.SizeBytes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set up decryption", err)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("ETag", `"`+obj.Hash+`"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", obj.CreatedAt, reader)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandlerLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.signUp("walt@example.com")
+
+	rec := s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "hunter2"})
+	expectStatus(t, rec, http.StatusOK)
+	login := decodeJSON[struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}](t, rec)
+	if login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("login = %+v, want both tokens", login)
+	}
+	expectStatus(t, s.do("GET", "/api/videos", login.Token, nil), http.StatusOK)
+
+	rec = s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "wrong"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = s.do("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "hunter2"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func loginRefreshToken(t *testing.T, s *testServer) string {
+	t.Helper()
+	rec := s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "hunter2"})
+	expectStatus(t, rec, http.StatusOK)
+	return decodeJSON[struct {
+		RefreshToken string `json:"refresh_token"`
+	}](t, rec).RefreshToken
+}
+
+func TestHandlerRefresh(t *testing.T) {
+	s := newTestServer(t)
+	s.signUp("walt@example.com")
+	refreshToken := loginRefreshToken(t, s)
+
+	rec := s.do("POST", "/api/refresh", refreshToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	token := decodeJSON[struct {
+		Token string `json:"token"`
+	}](t, rec).Token
+	expectStatus(t, s.do("GET", "/api/videos", token, nil), http.StatusOK)
+
+	expectStatus(t, s.do("POST", "/api/refresh", "", nil), http.StatusBadRequest)
+	expectStatus(t, s.do("POST", "/api/refresh", "not-a-token", nil), http.StatusUnauthorized)
+}
+
+func TestHandlerRevoke(t *testing.T) {
+	s := newTestServer(t)
+	s.signUp("walt@example.com")
+	refreshToken := loginRefreshToken(t, s)
+
+	expectStatus(t, s.do("POST", "/api/revoke", refreshToken, nil), http.StatusNoContent)
+	expectStatus(t, s.do("POST", "/api/revoke", "", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoTagsUpdate(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String() + "/tags"
+
+	rec := s.do("PUT", path, token, map[string]any{"tags": []string{"Drama", "  new   mexico ", "drama"}})
+	expectStatus(t, rec, http.StatusOK)
+	if tags := decodeJSON[database.Video](t, rec).Tags; !slices.Equal(tags, []string{"drama", "new mexico"}) {
+		t.Errorf("tags = %q, want [drama new mexico]", tags)
+	}
+
+	expectStatus(t, s.do("PUT", path, token, map[string]any{"tags": []string{"drama!"}}), http.StatusBadRequest)
+	expectStatus(t, s.do("PUT", path, otherToken, map[string]any{"tags": []string{"mine"}}), http.StatusForbidden)
+	expectStatus(t, s.do("PUT", "/api/videos/"+uuid.NewString()+"/tags", token, map[string]any{"tags": []string{}}), http.StatusNotFound)
+}
+
+func TestHandlerTagsList(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	for _, tags := range [][]string{{"drama", "chemistry"}, {"drama"}} {
+		rec := s.do("POST", "/api/videos", token, map[string]any{"title": "Episode", "tags": tags})
+		expectStatus(t, rec, http.StatusCreated)
+	}
+	rec := s.do("POST", "/api/videos", otherToken, map[string]any{"title": "Episode", "tags": []string{"comedy"}})
+	expectStatus(t, rec, http.StatusCreated)
+
+	rec = s.do("GET", "/api/tags", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	want := []database.TagCount{{Name: "drama", VideoCount: 2}, {Name: "chemistry", VideoCount: 1}}
+	if tags := decodeJSON[[]database.TagCount](t, rec); !slices.Equal(tags, want) {
+		t.Errorf("tags = %+v, want %+v", tags, want)
+	}
+
+	expectStatus(t, s.do("GET", "/api/tags", "", nil), http.StatusUnauthorized)
+}
@@ -2,14 +2,12 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/google/uuid"
@@ -35,18 +33,21 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	videoMetaData, err := cfg.db.GetVideo(videoID)
+	videoMetaData, err := cfg.store.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if videoMetaData.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 
 	if videoMetaData.UserID != userID {
 		respondWithError(w, http.StatusUnauthorized, "You can't upload a thumbnail for this video", nil)
 		return
 	}
 
-
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
 	maxMemory := int64(10 << 20) // 10 MB
@@ -79,41 +80,93 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	randomBytes := make([]byte, 32)
-	_, err = rand.Read(randomBytes)
+	hash, size, err := hashFile(bytes.NewReader(imageBytes))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't generate random bytes", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash thumbnail", err)
 		return
 	}
-	randomFileName := base64.RawURLEncoding.EncodeToString(randomBytes)
-	imagePath := filepath.Join(cfg.assetsRoot, fmt.Sprintf("%s.%s", randomFileName, mediaType[6:]))
-	imageFile, err := os.Create(imagePath)
+	key, err := cfg.thumbnailKeyTemplate.render(keyVars{
+		UserID:  userID,
+		VideoID: videoID,
+		Variant: "thumbnail",
+		Ext:     mediaType[6:],
+		Hash:    hash,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create image file", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't build thumbnail key", err)
 		return
 	}
-	defer imageFile.Close()
 
-	_, err = io.Copy(imageFile, bytes.NewReader(imageBytes))
+	ok, msg, err := cfg.reserveStorage(r.Context(), cfg.store, userID, size)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't write image file", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
 		return
 	}
+	if !ok {
+		respondWithError(w, http.StatusRequestEntityTooLarge, msg, nil)
+		return
+	}
+	releaseReservation := func() {
+		if err := cfg.store.AddUserStorageUsage(r.Context(), userID, -size); err != nil {
+			log.Printf("Couldn't release storage reservation for user %s: %v", userID, err)
+		}
+	}
 
-	imageURL := fmt.Sprintf("http://localhost:%s/assets/%s.%s", cfg.port, randomFileName, mediaType[6:])
-	videoMetaData.ThumbnailURL = &imageURL
+	obj, err := cfg.storeObject(r.Context(), bytes.NewReader(imageBytes), hash, size, key, mediaType, cfg.thumbnailKeyTemplate.dedupOwner(userID), false)
+	if err != nil {
+		releaseReservation()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload thumbnail", err)
+		return
+	}
+
+	var previousKey string
+	if videoMetaData.ThumbnailURL != nil {
+		previousKey, _ = cfg.objectKeyFromStored(*videoMetaData.ThumbnailURL)
+	}
+	videoMetaData.ThumbnailURL = &obj.ObjectKey
 
-	err = cfg.db.UpdateVideo(videoMetaData)
+	err = cfg.store.UpdateVideo(r.Context(), videoMetaData)
 	if err != nil {
+		if releaseErr := cfg.releaseObject(r.Context(), obj.ObjectKey); releaseErr != nil {
+			log.Printf("Couldn't release thumbnail %s: %v", obj.ObjectKey, releaseErr)
+		}
+		releaseReservation()
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	if previousKey != "" {
+		cfg.releaseThumbnail(r.Context(), userID, previousKey)
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
 		return
 	}
 
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, video)
 }
+
+// releaseThumbnail drops a video's reference to a thumbnail it no longer
+// uses and gives the space it took back to the video's owner. Only
+// thumbnails with a content object were counted against the quota.
+func (cfg *apiConfig) releaseThumbnail(ctx context.Context, ownerID uuid.UUID, key string) {
+	obj, err := cfg.store.GetContentObjectByKey(ctx, key)
+	if err != nil {
+		log.Printf("Couldn't get thumbnail %s: %v", key, err)
+	} else if obj.ObjectKey != "" {
+		if err := cfg.store.AddUserStorageUsage(ctx, ownerID, -obj.SizeBytes); err != nil {
+			log.Printf("Couldn't release storage of thumbnail %s for user %s: %v", key, ownerID, err)
+		}
+	}
+	if err := cfg.releaseObject(ctx, key); err != nil {
+		log.Printf("Couldn't release thumbnail %s: %v", key, err)
+	}
+}
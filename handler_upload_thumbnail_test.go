@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadThumbnail(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/thumbnail_upload/" + video.ID.String()
+
+	image := []byte("not really a png")
+	rec := s.upload(path, token, "thumbnail", "image/png", image, nil)
+	expectStatus(t, rec, http.StatusOK)
+	sum := sha256.Sum256(image)
+	key := hex.EncodeToString(sum[:]) + ".png"
+	if got := decodeJSON[database.Video](t, rec).ThumbnailURL; got == nil || *got != testCDN+"/"+key {
+		t.Errorf("thumbnail_url = %v, want %s/%s", got, testCDN, key)
+	}
+	if obj, ok := s.bucket.get(key); !ok || string(obj.data) != string(image) || obj.contentType != "image/png" {
+		t.Errorf("bucket has %+v under %s, want the thumbnail", obj, key)
+	}
+
+	// Replacing the thumbnail deletes the old object, which nothing else
+	// refers to.
+	rec = s.upload(path, token, "thumbnail", "image/jpeg", []byte("not really a jpeg"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	if _, ok := s.bucket.get(key); ok {
+		t.Errorf("previous thumbnail %s is still in the bucket", key)
+	}
+
+	expectStatus(t, s.upload(path, token, "thumbnail", "image/gif", image, nil), http.StatusBadRequest)
+	expectStatus(t, s.upload(path, otherToken, "thumbnail", "image/png", image, nil), http.StatusUnauthorized)
+	expectStatus(t, s.upload("/api/thumbnail_upload/"+uuid.NewString(), token, "thumbnail", "image/png", image, nil), http.StatusNotFound)
+}
+
+// TestHandlerUploadThumbnailOwnedKeys checks that uploads under keys naming
+// the user only share objects with that user's own uploads.
+func TestHandlerUploadThumbnailOwnedKeys(t *testing.T) {
+	s := newTestServer(t)
+	template, err := parseKeyTemplate("thumbnails/{userID}/{hash}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.thumbnailKeyTemplate = template
+	waltToken, waltID := s.signUp("walt@example.com")
+	jesseToken, jesseID := s.signUp("jesse@example.com")
+
+	image := []byte("not really a png")
+	sum := sha256.Sum256(image)
+	upload := func(token string, video database.Video) string {
+		t.Helper()
+		rec := s.upload("/api/thumbnail_upload/"+video.ID.String(), token, "thumbnail", "image/png", image, nil)
+		expectStatus(t, rec, http.StatusOK)
+		return *decodeJSON[database.Video](t, rec).ThumbnailURL
+	}
+	waltURL := upload(waltToken, s.createVideo(waltToken, "Pilot"))
+	jesseURL := upload(jesseToken, s.createVideo(jesseToken, "Pilot (copy)"))
+
+	for userID, url := range map[uuid.UUID]string{waltID: waltURL, jesseID: jesseURL} {
+		key := "thumbnails/" + userID.String() + "/" + hex.EncodeToString(sum[:]) + ".png"
+		if url != testCDN+"/"+key {
+			t.Errorf("thumbnail_url = %s, want %s/%s", url, testCDN, key)
+		}
+		if _, ok := s.bucket.get(key); !ok {
+			t.Errorf("bucket is missing %s", key)
+		}
+	}
+
+	// The same user uploading the same bytes again shares the first object.
+	if url := upload(waltToken, s.createVideo(waltToken, "Cat's in the Bag")); url != waltURL {
+		t.Errorf("second upload by the same user = %s, want %s", url, waltURL)
+	}
+	if n := s.bucket.len(); n != 2 {
+		t.Errorf("bucket has %d objects, want one per user", n)
+	}
+}
@@ -1,26 +1,30 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
 type ffprobeVideoFormat struct {
 	Streams []struct {
-		Width		int		`json:"width"`
-		Height		int		`json:"height"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
 	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
 }
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
@@ -43,11 +47,15 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	videoMetaData, err := cfg.db.GetVideo(videoID)
+	videoMetaData, err := cfg.store.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if videoMetaData.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 	if videoMetaData.UserID != userID {
 		respondWithError(w, http.StatusUnauthorized, "You don't have permission to acces this resource", nil)
 		return
@@ -55,20 +63,41 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	fmt.Println("uploading video", videoID, "by user", userID)
 
+	usage, err := cfg.store.GetUserUsage(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+	quotaBytes, _ := cfg.quotaFor(usage)
+	remainingBytes := int64(0)
+	if quotaBytes > 0 {
+		remainingBytes = quotaBytes - usage.StorageUsedBytes
+		if remainingBytes <= 0 {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Your storage quota of %d bytes is used up", quotaBytes), nil)
+			return
+		}
+	}
+
+	checksum, err := parseUploadChecksum(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid checksum", err)
+		return
+	}
+
 	r.Body = http.MaxBytesReader(w, r.Body, uploadLimit)
-	err = r.ParseMultipartForm(uploadLimit)
+	reader, err := r.MultipartReader()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "File too large or couldn't parse multipart form", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't read multipart form", err)
 		return
 	}
-	file, fileHeader, err := r.FormFile("video")
+	part, err := nextFormPart(reader, "video")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get file from form", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get file from form", err)
 		return
 	}
-	defer file.Close()
+	defer part.Close()
 
-	mediaTypeHeader := fileHeader.Header.Get("Content-Type")
+	mediaTypeHeader := part.Header.Get("Content-Type")
 	mediaType, _, err := mime.ParseMediaType(mediaTypeHeader)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't parse media type", err)
@@ -87,32 +116,52 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	defer os.Remove(newFile.Name())
 	defer newFile.Close()
 
-	_, err = io.Copy(newFile, file)
+	received := &byteCounter{limit: remainingBytes}
+	writers := []io.Writer{newFile, received}
+	if checksum != nil {
+		writers = append(writers, checksum)
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), part)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File too large", err)
+			return
+		}
+		if errors.Is(err, errUploadLimit) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload would exceed your storage quota: %d of %d bytes used", usage.StorageUsedBytes, quotaBytes), err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Couldn't copy file", err)
 		return
 	}
-	randomBytes := make([]byte, 32)
-	_, err = rand.Read(randomBytes)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't generate random bytes", err)
-		return
+	if checksum != nil {
+		if err := checksum.verify(); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Uploaded file doesn't match its checksum", err)
+			return
+		}
 	}
 
-	newFilePath, err := processVideoForFastStart(newFile.Name())
+	processedFilePath, err := processVideoForFastStart(newFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't process video for fast start", err)
 		return
 	}
-	newFile, err = os.Open(newFilePath)
+	defer os.Remove(processedFilePath)
+	processedFile, err := os.Open(processedFilePath)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't open processed video file", err)
 		return
 	}
-	defer os.Remove(newFilePath)
-	defer newFile.Close()
+	defer processedFile.Close()
 
-	aspectRatio, err := getVideoAspectRatio(newFile.Name())
+	hash, size, err := hashFile(processedFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash processed video file", err)
+		return
+	}
+
+	aspectRatio, duration, err := getVideoAspectRatio(processedFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get video aspect ratio", err)
 		return
@@ -124,55 +173,120 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	} else {
 		aspectRatio = "other"
 	}
-	randomFileName := aspectRatio + "-" + base64.RawURLEncoding.EncodeToString(randomBytes) + ".mp4"
-	
+	key, err := cfg.videoKeyTemplate.render(keyVars{
+		UserID:  userID,
+		VideoID: videoID,
+		Variant: aspectRatio,
+		Ext:     "mp4",
+		Hash:    hash,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't build object key", err)
+		return
+	}
 
-	if _, err := newFile.Seek(0, io.SeekStart); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't seek file", err)
+	ok, msg, err := cfg.reserveStorage(r.Context(), cfg.store, userID, size)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
 		return
 	}
+	if !ok {
+		respondWithError(w, http.StatusRequestEntityTooLarge, msg, nil)
+		return
+	}
+	releaseReservation := func() {
+		if err := cfg.store.AddUserStorageUsage(r.Context(), userID, -size); err != nil {
+			log.Printf("Couldn't release storage reservation for user %s: %v", userID, err)
+		}
+	}
 
-	_, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket: &cfg.s3Bucket,
-		Key:    &randomFileName,
-		Body:   newFile,
-		ContentType: &mediaTypeHeader,
-	})
+	obj, err := cfg.storeObject(r.Context(), processedFile, hash, size, key, mediaType, cfg.videoKeyTemplate.dedupOwner(userID), cfg.encryptsMedia())
 	if err != nil {
+		releaseReservation()
 		respondWithError(w, http.StatusInternalServerError, "Couldn't upload file to S3", err)
 		return
 	}
+	releaseObject := func() {
+		releaseReservation()
+		if err := cfg.releaseObject(r.Context(), obj.ObjectKey); err != nil {
+			log.Printf("Couldn't release object %s: %v", obj.ObjectKey, err)
+		}
+	}
 
-	urlName := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, randomFileName)
-	videoMetaData.VideoURL = &urlName
+	storedChecksum, err := sha256HexToBase64(obj.Hash)
+	if err != nil {
+		releaseObject()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't encode checksum", err)
+		return
+	}
 
-	err = cfg.db.UpdateVideo(videoMetaData)
+	previousURL := videoMetaData.VideoURL
+	err = cfg.store.WithTx(r.Context(), func(tx database.Store) error {
+		version, err := tx.CreateVideoVersion(r.Context(), database.CreateVideoVersionParams{
+			VideoID:         videoID,
+			ObjectKey:       obj.ObjectKey,
+			SizeBytes:       obj.SizeBytes,
+			ContentType:     mediaType,
+			AspectRatio:     aspectRatio,
+			UploadedBy:      userID,
+			ChecksumSHA256:  storedChecksum,
+			DurationSeconds: duration,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't record video version: %w", err)
+		}
+		videoMetaData.VideoURL = &obj.ObjectKey
+		videoMetaData.CurrentVersion = &version.Version
+		videoMetaData.VideoChecksumSHA256 = &version.ChecksumSHA256
+		videoMetaData.EncryptionKeyID = obj.EncryptionKeyID
+		videoMetaData.DurationSeconds = duration
+		videoMetaData.Orientation = &aspectRatio
+		return tx.UpdateVideo(r.Context(), videoMetaData)
+	})
 	if err != nil {
+		releaseObject()
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
 
+	if previousURL != nil {
+		if previousKey, ok := cfg.objectKeyFromStored(*previousURL); ok && previousKey != obj.ObjectKey {
+			cfg.invalidateCDN(previousKey)
+		}
+	}
+
+	err = cfg.pruneVideoVersions(r.Context(), videoMetaData)
+	if err != nil {
+		log.Printf("Couldn't prune old versions of video %s: %v", videoID, err)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func getVideoAspectRatio(filepath string) (string, error) {
-	command := fmt.Sprintf("ffprobe -v error -print_format json -show_streams %s", filepath)
+// getVideoAspectRatio also returns the video's duration in seconds, or nil
+// when ffprobe doesn't report one.
+func getVideoAspectRatio(filepath string) (string, *float64, error) {
+	command := fmt.Sprintf("ffprobe -v error -print_format json -show_streams -show_format %s", filepath)
 	out, err := exec.Command("bash", "-c", command).Output()
 	if err != nil {
-		return "", fmt.Errorf("ffprobe command failed: %w", err)
+		return "", nil, fmt.Errorf("ffprobe command failed: %w", err)
 	}
 	var ffprobeVideo ffprobeVideoFormat
 
 	if err := json.Unmarshal(out, &ffprobeVideo); err != nil {
-		return "", fmt.Errorf("unmarshalling ffprobe output failed: %w", err)
+		return "", nil, fmt.Errorf("unmarshalling ffprobe output failed: %w", err)
 	}
 	if len(ffprobeVideo.Streams) == 0 {
-		return "", fmt.Errorf("no video streams found in ffprobe output")
+		return "", nil, fmt.Errorf("no video streams found in ffprobe output")
 	}
 	width := ffprobeVideo.Streams[0].Width
 	height := ffprobeVideo.Streams[0].Height
 	if height == 0 || width == 0 {
-		return "", fmt.Errorf("invalid video dimensions: %dx%d", width, height)
+		return "", nil, fmt.Errorf("invalid video dimensions: %dx%d", width, height)
+	}
+	var duration *float64
+	if seconds, err := strconv.ParseFloat(ffprobeVideo.Format.Duration, 64); err == nil {
+		duration = &seconds
 	}
 	gcd := func(a, b int) int {
 		for b != 0 {
@@ -180,17 +294,22 @@ func getVideoAspectRatio(filepath string) (string, error) {
 		}
 		return a
 	}
-	
+
 	divisor := gcd(width, height)
-	return fmt.Sprintf("%d:%d", width/divisor, height/divisor), nil	
+	return fmt.Sprintf("%d:%d", width/divisor, height/divisor), duration, nil
 }
 
+// processVideoForFastStart remuxes the video with its moov atom in front,
+// so players can start before it has fully downloaded, and returns the path
+// of the result. ffmpeg can only move the moov atom in a seekable file, so
+// the result is written next to the input rather than streamed.
 func processVideoForFastStart(filepath string) (string, error) {
 	outputFilePath := filepath + ".processing"
 
 	cmd := exec.Command("ffmpeg", "-i", filepath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilePath)
 	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
 		return "", fmt.Errorf("ffmpeg command failed: %w", err)
 	}
 	return outputFilePath, nil
-}
\ No newline at end of file
+}
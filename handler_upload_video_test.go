@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadVideo(t *testing.T) {
+	installFakeMediaTools(t)
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/video_upload/" + video.ID.String()
+
+	data := []byte("not really an mp4")
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	header := http.Header{checksumHeaderSHA256: {checksum}}
+	expectStatus(t, s.upload(path, token, "video", "video/mp4", data, header), http.StatusNoContent)
+
+	rec := s.do("GET", "/api/videos/"+video.ID.String(), token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	uploaded := decodeJSON[database.Video](t, rec)
+	if uploaded.CurrentVersion == nil || *uploaded.CurrentVersion != 1 {
+		t.Errorf("current_version = %v, want 1", uploaded.CurrentVersion)
+	}
+	if uploaded.VideoChecksumSHA256 == nil || *uploaded.VideoChecksumSHA256 != checksum {
+		t.Errorf("video_checksum_sha256 = %v, want %s", uploaded.VideoChecksumSHA256, checksum)
+	}
+	if uploaded.Orientation == nil || *uploaded.Orientation != "landscape" {
+		t.Errorf("orientation = %v, want landscape", uploaded.Orientation)
+	}
+	if uploaded.DurationSeconds == nil || *uploaded.DurationSeconds != 12.5 {
+		t.Errorf("duration_seconds = %v, want 12.5", uploaded.DurationSeconds)
+	}
+	versions, err := s.store.GetVideoVersions(context.Background(), video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("versions = %+v, want one", versions)
+	}
+	if obj, ok := s.bucket.get(versions[0].ObjectKey); !ok || string(obj.data) != string(data) {
+		t.Errorf("bucket has %+v under %s, want the video", obj, versions[0].ObjectKey)
+	}
+	usage, err := s.store.GetUserUsage(context.Background(), uploaded.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.StorageUsedBytes != int64(len(data)) {
+		t.Errorf("storage_used_bytes = %d, want %d", usage.StorageUsedBytes, len(data))
+	}
+
+	badChecksum := http.Header{checksumHeaderSHA256: {base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}}
+	expectStatus(t, s.upload(path, token, "video", "video/mp4", data, badChecksum), http.StatusBadRequest)
+	expectStatus(t, s.upload(path, token, "video", "video/quicktime", data, nil), http.StatusBadRequest)
+	expectStatus(t, s.upload(path, otherToken, "video", "video/mp4", data, nil), http.StatusUnauthorized)
+	expectStatus(t, s.upload("/api/video_upload/"+uuid.NewString(), token, "video", "video/mp4", data, nil), http.StatusNotFound)
+}
+
+// uploadVideo uploads data as a new version of the video.
+func (s *testServer) uploadVideo(token string, videoID uuid.UUID, data []byte) {
+	s.t.Helper()
+	rec := s.upload("/api/video_upload/"+videoID.String(), token, "video", "video/mp4", data, nil)
+	expectStatus(s.t, rec, http.StatusNoContent)
+}
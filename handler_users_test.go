@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandlerUsersCreate(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do("POST", "/api/users", "", map[string]string{"email": "walt@example.com", "password": "hunter2"})
+	expectStatus(t, rec, http.StatusCreated)
+	user := decodeJSON[struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}](t, rec)
+	if user.Email != "walt@example.com" {
+		t.Errorf("email = %q, want walt@example.com", user.Email)
+	}
+	if user.Password == "hunter2" {
+		t.Error("password was stored in plain text")
+	}
+
+	rec = s.do("POST", "/api/users", "", map[string]string{"email": "jesse@example.com"})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
@@ -2,7 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -33,12 +42,35 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	params.Tags, err = normalizeTags(params.Tags)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tags: "+err.Error(), err)
+		return
+	}
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	var video database.Video
+	var quotaMessage string
+	err = cfg.store.WithTx(r.Context(), func(tx database.Store) error {
+		quotaMessage = ""
+		ok, msg, err := cfg.reserveVideo(r.Context(), tx, userID)
+		if err != nil {
+			return fmt.Errorf("couldn't check video quota: %w", err)
+		}
+		if !ok {
+			quotaMessage = msg
+			return nil
+		}
+		video, err = tx.CreateVideo(r.Context(), params.CreateVideoParams)
+		return err
+	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
+	if quotaMessage != "" {
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaMessage, nil)
+		return
+	}
 
 	respondWithJSON(w, http.StatusCreated, video)
 }
@@ -62,17 +94,23 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 	if video.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	// The video goes to the trash; purgeTrash deletes it and its media once
+	// the retention period has passed.
+	err = cfg.store.TrashVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -89,16 +127,225 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		// Missing, or in the trash.
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	viewerID := cfg.viewerID(r)
+	if cfg.restrictsVideo(video) && !canViewVideo(viewerID, video) {
+		video.VideoURL = nil
+	}
+	etag := cfg.videoViewETag(video, viewerID)
+
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
+// videoETag tags the version of a video's metadata, which changes with
+// every update.
+func videoETag(video database.Video) string {
+	return `"` + strconv.FormatInt(video.UpdatedAt.UnixMicro(), 10) + `"`
+}
+
+// videoViewETag tags what handlerVideoGet returns to viewerID: the video's
+// version and the viewer, whose access decides whether video_url is shown.
+// Signed URLs differ on every request, so instead of the body the tag names
+// the half of their lifetime they were signed in; a client revalidating its
+// copy is sent new ones before the old ones expire.
+func (cfg *apiConfig) videoViewETag(video database.Video, viewerID uuid.UUID) string {
+	etag := strings.TrimSuffix(videoETag(video), `"`) + "." + viewerID.String()
+	if lifetime := cfg.signedURLLifetime(video); lifetime > 0 {
+		window := max(int64((lifetime / 2).Seconds()), 1)
+		etag += "." + strconv.FormatInt(time.Now().Unix()/window, 10)
+	}
+	return etag + `"`
+}
+
+// handlerVideoMetaUpdate applies a JSON merge patch (RFC 7396) to the title,
+// description and tags of one of the caller's videos. If-Match must name the
+// video's current ETag, so an edit made from a stale copy is refused rather
+// than overwriting a newer one.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", nil)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		respondWithError(w, http.StatusPreconditionRequired, "If-Match header is required", nil)
+		return
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+
+	patch, err := decodeVideoPatch(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid patch: "+err.Error(), err)
+		return
+	}
+
+	if !versionETagMatches(ifMatch, videoETag(video)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was read", nil)
+		return
+	}
+
+	if patch.Title != nil {
+		video.Title = *patch.Title
+	}
+	if patch.SetDescription {
+		video.Description = patch.Description
+	}
+	err = cfg.store.WithTx(r.Context(), func(tx database.Store) error {
+		if err := tx.UpdateVideoIfUnchanged(r.Context(), video); err != nil {
+			return err
+		}
+		if patch.Tags != nil {
+			return tx.SetVideoTags(r.Context(), videoID, *patch.Tags)
+		}
+		return nil
+	})
+	if errors.Is(err, database.ErrVideoModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was read", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	video, err = cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusOK, video)
 }
 
+// videoPatch holds the fields a merge patch sets. A nil field is left
+// alone; nulls in the patch clear the description and tags. The description
+// is only set when SetDescription is, since nil clears it.
+type videoPatch struct {
+	Title          *string
+	SetDescription bool
+	Description    *string
+	Tags           *[]string
+}
+
+func decodeVideoPatch(body io.Reader) (videoPatch, error) {
+	var patch videoPatch
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return patch, errors.New("body must be a JSON object")
+	}
+	if fields == nil {
+		return patch, errors.New("body must be a JSON object")
+	}
+
+	for name, value := range fields {
+		isNull := string(value) == "null"
+		switch name {
+		case "title":
+			var title string
+			if isNull || json.Unmarshal(value, &title) != nil {
+				return patch, errors.New("title must be a string")
+			}
+			title = strings.TrimSpace(title)
+			if title == "" {
+				return patch, errors.New("title can't be empty")
+			}
+			if utf8.RuneCountInString(title) > maxVideoTitleLength {
+				return patch, fmt.Errorf("title can't be longer than %d characters", maxVideoTitleLength)
+			}
+			patch.Title = &title
+		case "description":
+			var description *string
+			if json.Unmarshal(value, &description) != nil {
+				return patch, errors.New("description must be a string or null")
+			}
+			if description != nil && utf8.RuneCountInString(*description) > maxVideoDescriptionLength {
+				return patch, fmt.Errorf("description can't be longer than %d characters", maxVideoDescriptionLength)
+			}
+			patch.SetDescription = true
+			patch.Description = description
+		case "tags":
+			var tags []string
+			if !isNull && json.Unmarshal(value, &tags) != nil {
+				return patch, errors.New("tags must be a list of strings or null")
+			}
+			tags, err := normalizeTags(tags)
+			if err != nil {
+				return patch, err
+			}
+			patch.Tags = &tags
+		default:
+			return patch, fmt.Errorf("%s can't be changed", name)
+		}
+	}
+	return patch, nil
+}
+
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Videos     []database.Video `json:"videos"`
+		NextCursor *string          `json:"next_cursor"`
+	}
+
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
@@ -110,11 +357,143 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, err := parseListVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid list parameters: "+err.Error(), err)
+		return
+	}
+	params.UserID = userID
+
+	videos, next, err := cfg.store.ListVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	for i, video := range videos {
+		videos[i], err = cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+			return
+		}
+	}
+
+	resp := response{Videos: videos}
+	if next != nil {
+		cursor := next.Encode()
+		resp.NextCursor = &cursor
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+const (
+	defaultVideoPageSize = 50
+	maxVideoPageSize     = 100
+)
+
+// parseListVideosParams reads the list query: limit, cursor, sort (created,
+// updated, title or duration), order (asc or desc; titles default to asc,
+// everything else to desc) and the filters has_video, has_thumbnail,
+// orientation, created_after, created_before and tags, a comma-separated
+// list matched by tag_match (all, the default, or any). Dates are RFC 3339
+// times or plain YYYY-MM-DD days.
+func parseListVideosParams(query url.Values) (database.ListVideosParams, error) {
+	params := database.ListVideosParams{
+		Sort:  database.VideoSortCreated,
+		Limit: defaultVideoPageSize,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+		}
+		params.Limit = n
+	}
+
+	switch sort := database.VideoSort(query.Get("sort")); sort {
+	case "":
+	case database.VideoSortCreated, database.VideoSortUpdated, database.VideoSortTitle, database.VideoSortDuration:
+		params.Sort = sort
+	default:
+		return params, errors.New("sort must be created, updated, title or duration")
+	}
+	switch query.Get("order") {
+	case "":
+		params.Descending = params.Sort != database.VideoSortTitle
+	case "asc":
+	case "desc":
+		params.Descending = true
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		vc, err := database.DecodeVideoCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = &vc
+	}
+
+	var err error
+	if params.HasVideo, err = parseBoolFilter(query, "has_video"); err != nil {
+		return params, err
+	}
+	if params.HasThumbnail, err = parseBoolFilter(query, "has_thumbnail"); err != nil {
+		return params, err
+	}
+	if orientation := query.Get("orientation"); orientation != "" {
+		if orientation != "landscape" && orientation != "portrait" && orientation != "other" {
+			return params, errors.New("orientation must be landscape, portrait or other")
+		}
+		params.Orientation = &orientation
+	}
+	if params.CreatedAfter, err = parseDateFilter(query, "created_after"); err != nil {
+		return params, err
+	}
+	if params.CreatedBefore, err = parseDateFilter(query, "created_before"); err != nil {
+		return params, err
+	}
+	if tags := query.Get("tags"); tags != "" {
+		if params.Tags, err = normalizeTags(strings.Split(tags, ",")); err != nil {
+			return params, err
+		}
+	}
+	switch query.Get("tag_match") {
+	case "", "all":
+		params.MatchAllTags = true
+	case "any":
+	default:
+		return params, errors.New("tag_match must be all or any")
+	}
+	return params, nil
+}
+
+func parseBoolFilter(query url.Values, name string) (*bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+func parseDateFilter(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
 }
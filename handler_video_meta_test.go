@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoMetaCreate(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.quotaVideos = 1
+	token, userID := s.signUp("walt@example.com")
+
+	rec := s.do("POST", "/api/videos", token, map[string]any{"title": "Pilot", "tags": []string{" Chemistry ", "chemistry"}})
+	expectStatus(t, rec, http.StatusCreated)
+	video := decodeJSON[database.Video](t, rec)
+	if video.UserID != userID || video.Title != "Pilot" {
+		t.Errorf("video = %+v, want Pilot owned by %s", video, userID)
+	}
+	if len(video.Tags) != 1 || video.Tags[0] != "chemistry" {
+		t.Errorf("tags = %q, want [chemistry]", video.Tags)
+	}
+	if video.Description != nil {
+		t.Errorf("description = %q, want none", *video.Description)
+	}
+
+	rec = s.do("POST", "/api/videos", token, map[string]any{"title": "Cat's in the Bag"})
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	rec = s.do("POST", "/api/videos", "", map[string]any{"title": "Pilot"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestHandlerVideosRetrieve(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	s.createVideo(token, "Pilot")
+	s.createVideo(token, "Cat's in the Bag")
+	s.createVideo(otherToken, "Crazy Handful of Nothin'")
+
+	type page struct {
+		Videos     []database.Video `json:"videos"`
+		NextCursor *string          `json:"next_cursor"`
+	}
+	rec := s.do("GET", "/api/videos?sort=title&limit=1", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	first := decodeJSON[page](t, rec)
+	if len(first.Videos) != 1 || first.Videos[0].Title != "Cat's in the Bag" || first.NextCursor == nil {
+		t.Fatalf("first page = %+v, want Cat's in the Bag and a cursor", first)
+	}
+
+	rec = s.do("GET", "/api/videos?sort=title&limit=1&cursor="+*first.NextCursor, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	second := decodeJSON[page](t, rec)
+	if len(second.Videos) != 1 || second.Videos[0].Title != "Pilot" || second.NextCursor != nil {
+		t.Fatalf("second page = %+v, want only Pilot", second)
+	}
+
+	expectStatus(t, s.do("GET", "/api/videos?limit=0", token, nil), http.StatusBadRequest)
+	expectStatus(t, s.do("GET", "/api/videos?cursor=garbage", token, nil), http.StatusBadRequest)
+	expectStatus(t, s.do("GET", "/api/videos", "", nil), http.StatusUnauthorized)
+}
+
+func TestHandlerVideoGet(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	video := s.createVideo(token, "Pilot")
+	s.setVideoFile(video.ID, "landscape-pilot.mp4", []byte("video"))
+
+	rec := s.do("GET", "/api/videos/"+video.ID.String(), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	got := decodeJSON[database.Video](t, rec)
+	if got.VideoURL == nil || *got.VideoURL != testCDN+"/landscape-pilot.mp4" {
+		t.Errorf("video_url = %v, want the CDN URL", got.VideoURL)
+	}
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, strings.TrimSuffix(videoETag(got), `"`)+".") {
+		t.Errorf("ETag = %s, want it to start with the version %s", etag, videoETag(got))
+	}
+
+	req := httptest.NewRequest("GET", "/api/videos/"+video.ID.String(), nil)
+	req.Header.Set("If-None-Match", etag)
+	expectStatus(t, s.serve(req), http.StatusNotModified)
+
+	expectStatus(t, s.do("GET", "/api/videos/"+uuid.NewString(), "", nil), http.StatusNotFound)
+	expectStatus(t, s.do("GET", "/api/videos/not-a-uuid", "", nil), http.StatusBadRequest)
+}
+
+// TestHandlerVideoGetSignedURLs checks that presigned URLs, which differ on
+// every request, don't defeat revalidation, while the viewer and updates
+// still change the ETag.
+func TestHandlerVideoGetSignedURLs(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.s3PrivateBucket = true
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	s.setVideoFile(video.ID, "landscape-pilot.mp4", []byte("video"))
+	path := "/api/videos/" + video.ID.String()
+
+	get := func(token, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		return s.serve(req)
+	}
+
+	rec := get(token, "")
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[database.Video](t, rec); got.VideoURL == nil || !strings.Contains(*got.VideoURL, "X-Amz-Signature=") {
+		t.Fatalf("video_url = %v, want a presigned URL", got.VideoURL)
+	}
+	etag := rec.Header().Get("ETag")
+	expectStatus(t, get(token, etag), http.StatusNotModified)
+
+	// Others aren't given the URL, so their copy is tagged differently.
+	for _, other := range []string{otherToken, ""} {
+		rec := get(other, etag)
+		expectStatus(t, rec, http.StatusOK)
+		if got := decodeJSON[database.Video](t, rec); got.VideoURL != nil {
+			t.Errorf("video_url for another viewer = %s, want none", *got.VideoURL)
+		}
+		if rec.Header().Get("ETag") == etag {
+			t.Errorf("ETag for another viewer = %s, same as the owner's", etag)
+		}
+	}
+
+	rec = s.patchVideo(token, video.ID.String(), etag, map[string]any{"title": "Pilot (remastered)"})
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, get(token, etag), http.StatusOK)
+}
+
+func TestHandlerVideoMetaUpdate(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String()
+
+	patch := func(token, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return s.serve(req)
+	}
+
+	etag := s.do("GET", path, token, nil).Header().Get("ETag")
+	rec := patch(token, etag, `{"title": " Pilot (remastered) ", "description": null, "tags": ["drama"]}`)
+	expectStatus(t, rec, http.StatusOK)
+	updated := decodeJSON[database.Video](t, rec)
+	if updated.Title != "Pilot (remastered)" || updated.Description != nil {
+		t.Errorf("video = %+v, want the new title and no description", updated)
+	}
+	if len(updated.Tags) != 1 || updated.Tags[0] != "drama" {
+		t.Errorf("tags = %q, want [drama]", updated.Tags)
+	}
+
+	// The first update changed the version the ETag names.
+	expectStatus(t, patch(token, etag, `{"title": "Stale"}`), http.StatusPreconditionFailed)
+	expectStatus(t, patch(token, "", `{"title": "Stale"}`), http.StatusPreconditionRequired)
+	expectStatus(t, patch(token, "*", `{"user_id": "someone"}`), http.StatusBadRequest)
+	expectStatus(t, patch(otherToken, "*", `{"title": "Mine"}`), http.StatusForbidden)
+
+	req := httptest.NewRequest("PATCH", path, strings.NewReader(`{"title": "Plain"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("If-Match", "*")
+	expectStatus(t, s.serve(req), http.StatusUnsupportedMediaType)
+}
+
+func TestHandlerVideoMetaDelete(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String()
+
+	expectStatus(t, s.do("DELETE", path, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, s.do("DELETE", path, token, nil), http.StatusNoContent)
+	expectStatus(t, s.do("GET", path, token, nil), http.StatusNotFound)
+	expectStatus(t, s.do("DELETE", path, token, nil), http.StatusNotFound)
+}
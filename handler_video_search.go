@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchOffset       = 1000
+)
+
+// handlerVideosSearch finds the caller's videos whose title or description
+// match q, best match first.
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Results    []database.VideoSearchResult `json:"results"`
+		NextOffset *int                         `json:"next_offset"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params, err := parseSearchVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid search parameters: "+err.Error(), err)
+		return
+	}
+	params.UserID = userID
+
+	// One extra result tells whether there is a next page.
+	limit := params.Limit
+	params.Limit++
+	results, err := cfg.store.SearchVideos(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	resp := response{Results: results}
+	if len(results) > limit {
+		resp.Results = results[:limit]
+		next := params.Offset + limit
+		resp.NextOffset = &next
+	}
+	for i, result := range resp.Results {
+		resp.Results[i].Video, err = cfg.dbVideoToSignedVideo(r.Context(), result.Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// parseSearchVideosParams reads the search query: q, which needs at least
+// one word, and the page given by limit and offset.
+func parseSearchVideosParams(query url.Values) (database.SearchVideosParams, error) {
+	params := database.SearchVideosParams{
+		Query: query.Get("q"),
+		Limit: defaultSearchPageSize,
+	}
+	if len(database.SearchTerms(params.Query)) == 0 {
+		return params, errors.New("q must contain at least one word")
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+		}
+		params.Limit = n
+	}
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 || n > maxSearchOffset {
+			return params, fmt.Errorf("offset must be between 0 and %d", maxSearchOffset)
+		}
+		params.Offset = n
+	}
+	return params, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVideosSearch(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	title := s.createVideo(token, "Chemistry lesson")
+	description := s.createVideo(token, "Pilot")
+	s.createVideo(token, "Gray Matter")
+	s.createVideo(otherToken, "Chemistry lab")
+
+	patch := map[string]any{"description": "An unexpected chemistry teacher"}
+	rec := s.patchVideo(token, description.ID.String(), "*", patch)
+	expectStatus(t, rec, http.StatusOK)
+
+	type page struct {
+		Results    []database.VideoSearchResult `json:"results"`
+		NextOffset *int                         `json:"next_offset"`
+	}
+	rec = s.do("GET", "/api/videos/search?q=chemistry&limit=1", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	first := decodeJSON[page](t, rec)
+	if len(first.Results) != 1 || first.Results[0].Video.ID != title.ID || first.NextOffset == nil {
+		t.Fatalf("first page = %+v, want the title match and a next offset", first)
+	}
+	if got := first.Results[0].TitleHighlight; got != "<mark>Chemistry</mark> lesson" {
+		t.Errorf("title_highlight = %q", got)
+	}
+
+	rec = s.do("GET", "/api/videos/search?q=chemistry&offset=1", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	second := decodeJSON[page](t, rec)
+	if len(second.Results) != 1 || second.Results[0].Video.ID != description.ID || second.NextOffset != nil {
+		t.Fatalf("second page = %+v, want only the description match", second)
+	}
+
+	expectStatus(t, s.do("GET", "/api/videos/search?q=", token, nil), http.StatusBadRequest)
+	expectStatus(t, s.do("GET", "/api/videos/search?q=chemistry&offset=-1", token, nil), http.StatusBadRequest)
+	expectStatus(t, s.do("GET", "/api/videos/search?q=chemistry", "", nil), http.StatusUnauthorized)
+}
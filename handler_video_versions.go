@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoVersionsList(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view the versions of this video", nil)
+		return
+	}
+
+	versions, err := cfg.store.GetVideoVersions(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video versions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, versions)
+}
+
+func (cfg *apiConfig) handlerVideoVersionRollback(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	versionNumber, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || versionNumber < 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid version", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't roll back this video", nil)
+		return
+	}
+
+	version, err := cfg.store.GetVideoVersion(r.Context(), videoID, versionNumber)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return
+	}
+	if version.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video version not found", nil)
+		return
+	}
+
+	obj, err := cfg.store.GetContentObjectByKey(r.Context(), version.ObjectKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video object", err)
+		return
+	}
+
+	video.VideoURL = &version.ObjectKey
+	video.EncryptionKeyID = obj.EncryptionKeyID
+	video.CurrentVersion = &version.Version
+	video.VideoChecksumSHA256 = nil
+	if version.ChecksumSHA256 != "" {
+		video.VideoChecksumSHA256 = &version.ChecksumSHA256
+	}
+	video.DurationSeconds = version.DurationSeconds
+	video.Orientation = &version.AspectRatio
+
+	err = cfg.store.UpdateVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	video, err = cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerUserVideoVersionLimit(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Limit *int `json:"limit"`
+	}
+	type response struct {
+		Limit          *int `json:"limit"`
+		EffectiveLimit int  `json:"effective_limit"`
+		MaxLimit       int  `json:"max_limit"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Limit != nil && (*params.Limit < 1 || *params.Limit > cfg.videoVersionLimit) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", cfg.videoVersionLimit), nil)
+		return
+	}
+
+	err = cfg.store.SetUserVideoVersionLimit(r.Context(), userID, params.Limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update version limit", err)
+		return
+	}
+
+	effectiveLimit, err := cfg.videoVersionLimitFor(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get version limit", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Limit:          params.Limit,
+		EffectiveLimit: effectiveLimit,
+		MaxLimit:       cfg.videoVersionLimit,
+	})
+}
+
+func (cfg *apiConfig) videoVersionLimitFor(ctx context.Context, userID uuid.UUID) (int, error) {
+	limit, err := cfg.store.GetUserVideoVersionLimit(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if limit == nil || *limit > cfg.videoVersionLimit {
+		return cfg.videoVersionLimit, nil
+	}
+	return *limit, nil
+}
+
+// pruneVideoVersions drops the oldest versions of a video once its owner's
+// retention limit is exceeded. The current version is always kept, even
+// after a rollback to an old one. A version that can't be dropped doesn't
+// stop the others from being pruned; their errors are returned joined.
+func (cfg *apiConfig) pruneVideoVersions(ctx context.Context, video database.Video) error {
+	limit, err := cfg.videoVersionLimitFor(ctx, video.UserID)
+	if err != nil {
+		return err
+	}
+
+	versions, err := cfg.store.GetVideoVersions(ctx, video.ID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	kept := 0
+	for _, version := range versions {
+		if video.CurrentVersion != nil && version.Version == *video.CurrentVersion {
+			continue
+		}
+		kept++
+		if kept < limit {
+			continue
+		}
+
+		err = cfg.store.WithTx(ctx, func(tx database.Store) error {
+			if err := tx.DeleteVideoVersion(ctx, version.ID); err != nil {
+				return err
+			}
+			return tx.AddUserStorageUsage(ctx, video.UserID, -version.SizeBytes)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't delete version %d: %w", version.Version, err))
+			continue
+		}
+		err = cfg.releaseObject(ctx, version.ObjectKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't release object %s: %w", version.ObjectKey, err))
+		}
+	}
+	return errors.Join(errs...)
+}
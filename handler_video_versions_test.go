@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerUserVideoVersionLimit(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+
+	type response struct {
+		Limit          *int `json:"limit"`
+		EffectiveLimit int  `json:"effective_limit"`
+		MaxLimit       int  `json:"max_limit"`
+	}
+	rec := s.do("PUT", "/api/users/me/video_version_limit", token, map[string]any{"limit": 2})
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[response](t, rec); got.Limit == nil || *got.Limit != 2 || got.EffectiveLimit != 2 || got.MaxLimit != 5 {
+		t.Errorf("response = %+v, want a limit of 2 out of 5", got)
+	}
+
+	rec = s.do("PUT", "/api/users/me/video_version_limit", token, map[string]any{"limit": nil})
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[response](t, rec); got.Limit != nil || got.EffectiveLimit != 5 {
+		t.Errorf("response = %+v, want the default limit of 5", got)
+	}
+
+	expectStatus(t, s.do("PUT", "/api/users/me/video_version_limit", token, map[string]any{"limit": 6}), http.StatusBadRequest)
+	expectStatus(t, s.do("PUT", "/api/users/me/video_version_limit", "", map[string]any{"limit": 2}), http.StatusUnauthorized)
+}
+
+func TestHandlerVideoVersions(t *testing.T) {
+	installFakeMediaTools(t)
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String()
+
+	expectStatus(t, s.do("PUT", "/api/users/me/video_version_limit", token, map[string]any{"limit": 2}), http.StatusOK)
+	for _, data := range []string{"first cut", "second cut", "final cut"} {
+		s.uploadVideo(token, video.ID, []byte(data))
+	}
+
+	rec := s.do("GET", path+"/versions", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	versions := decodeJSON[[]database.VideoVersion](t, rec)
+	if len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 2 {
+		t.Fatalf("versions = %+v, want 3 and 2 after pruning", versions)
+	}
+	if obj, ok := s.bucket.get(versions[1].ObjectKey); !ok || string(obj.data) != "second cut" {
+		t.Errorf("bucket has %+v under %s, want the second cut", obj, versions[1].ObjectKey)
+	}
+	if n := s.bucket.len(); n != 2 {
+		t.Errorf("bucket holds %d objects, want the pruned version's deleted", n)
+	}
+
+	rec = s.do("POST", path+"/versions/2/rollback", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	rolledBack := decodeJSON[database.Video](t, rec)
+	if rolledBack.CurrentVersion == nil || *rolledBack.CurrentVersion != 2 {
+		t.Errorf("current_version = %v, want 2", rolledBack.CurrentVersion)
+	}
+	if want := testCDN + "/" + versions[1].ObjectKey; rolledBack.VideoURL == nil || *rolledBack.VideoURL != want {
+		t.Errorf("video_url = %v, want %s", rolledBack.VideoURL, want)
+	}
+
+	expectStatus(t, s.do("POST", path+"/versions/1/rollback", token, nil), http.StatusNotFound)
+	expectStatus(t, s.do("POST", path+"/versions/0/rollback", token, nil), http.StatusBadRequest)
+	expectStatus(t, s.do("POST", path+"/versions/3/rollback", otherToken, nil), http.StatusForbidden)
+	expectStatus(t, s.do("GET", path+"/versions", otherToken, nil), http.StatusForbidden)
+}
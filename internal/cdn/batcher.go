@@ -0,0 +1,170 @@
+package cdn
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// CloudFront accepts at most this many paths in one invalidation batch.
+	maxBatchPaths = 3000
+	// maxFailed is how many failed submissions Pending reports. Their paths
+	// are requeued regardless, so only the record of older failures is lost
+	// while the CDN stays unreachable.
+	maxFailed = 20
+)
+
+type Invalidation struct {
+	ID        string    `json:"id"`
+	Paths     []string  `json:"paths"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Batcher collects changed paths and submits them as a single invalidation
+// every interval, then polls the invalidations it created until they
+// complete.
+type Batcher struct {
+	invalidator Invalidator
+	interval    time.Duration
+
+	mu      sync.Mutex
+	queued  map[string]struct{}
+	tracked map[string]*Invalidation
+	failed  []Invalidation
+}
+
+func NewBatcher(invalidator Invalidator, interval time.Duration) *Batcher {
+	return &Batcher{
+		invalidator: invalidator,
+		interval:    interval,
+		queued:      map[string]struct{}{},
+		tracked:     map[string]*Invalidation{},
+	}
+}
+
+// Enqueue schedules paths such as "/videos/abc.mp4" for the next batch.
+func (b *Batcher) Enqueue(paths ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, path := range paths {
+		b.queued[path] = struct{}{}
+	}
+}
+
+// Run flushes and polls until ctx is cancelled, then submits whatever is
+// still queued.
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.Flush(context.Background())
+			return
+		case <-ticker.C:
+			b.Flush(ctx)
+			b.poll(ctx)
+		}
+	}
+}
+
+// Flush submits the queued paths right away.
+func (b *Batcher) Flush(ctx context.Context) {
+	b.mu.Lock()
+	paths := make([]string, 0, len(b.queued))
+	for path := range b.queued {
+		paths = append(paths, path)
+	}
+	b.queued = map[string]struct{}{}
+	b.mu.Unlock()
+
+	sort.Strings(paths)
+	for len(paths) > 0 {
+		n := min(len(paths), maxBatchPaths)
+		b.submit(ctx, paths[:n])
+		paths = paths[n:]
+	}
+}
+
+func (b *Batcher) submit(ctx context.Context, paths []string) {
+	id, err := b.invalidator.CreateInvalidation(ctx, paths)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		log.Printf("Couldn't invalidate %d CDN paths, requeueing: %v", len(paths), err)
+		for _, path := range paths {
+			b.queued[path] = struct{}{}
+		}
+		b.failed = append(b.failed, Invalidation{
+			Paths:     paths,
+			Status:    "Failed",
+			CreatedAt: time.Now().UTC(),
+			Error:     err.Error(),
+		})
+		if len(b.failed) > maxFailed {
+			b.failed = slices.Delete(b.failed, 0, len(b.failed)-maxFailed)
+		}
+		return
+	}
+	// Anything that failed before was requeued into this batch.
+	b.failed = nil
+	b.tracked[id] = &Invalidation{
+		ID:        id,
+		Paths:     paths,
+		Status:    "InProgress",
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func (b *Batcher) poll(ctx context.Context) {
+	b.mu.Lock()
+	ids := make([]string, 0, len(b.tracked))
+	for id := range b.tracked {
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+
+	for _, id := range ids {
+		status, err := b.invalidator.InvalidationStatus(ctx, id)
+		if err != nil {
+			log.Printf("Couldn't check CDN invalidation %s: %v", id, err)
+			continue
+		}
+		b.mu.Lock()
+		if status == StatusCompleted {
+			delete(b.tracked, id)
+		} else if inv, ok := b.tracked[id]; ok {
+			inv.Status = status
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Pending lists the submitted invalidations that haven't completed yet,
+// along with recent submissions that failed and were requeued.
+func (b *Batcher) Pending() []Invalidation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := make([]Invalidation, 0, len(b.tracked)+len(b.failed))
+	for _, inv := range b.tracked {
+		pending = append(pending, *inv)
+	}
+	pending = append(pending, b.failed...)
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	return pending
+}
+
+// Queued returns how many paths are waiting for the next batch.
+func (b *Batcher) Queued() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queued)
+}
@@ -0,0 +1,134 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// flakyInvalidator fails CreateInvalidation while down is set.
+type flakyInvalidator struct {
+	*FakeInvalidator
+
+	mu   sync.Mutex
+	down bool
+}
+
+func (f *flakyInvalidator) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *flakyInvalidator) CreateInvalidation(ctx context.Context, paths []string) (string, error) {
+	f.mu.Lock()
+	down := f.down
+	f.mu.Unlock()
+	if down {
+		return "", errors.New("CDN unreachable")
+	}
+	return f.FakeInvalidator.CreateInvalidation(ctx, paths)
+}
+
+func TestBatcherFlush(t *testing.T) {
+	ctx := context.Background()
+	invalidator := NewFakeInvalidator()
+	b := NewBatcher(invalidator, 0)
+
+	paths := make([]string, maxBatchPaths+1)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/videos/%05d.mp4", i)
+	}
+	b.Enqueue(paths[maxBatchPaths:]...)
+	b.Enqueue(paths...)
+	if n := b.Queued(); n != len(paths) {
+		t.Fatalf("Queued = %d, want %d distinct paths", n, len(paths))
+	}
+
+	b.Flush(ctx)
+	if n := b.Queued(); n != 0 {
+		t.Errorf("Queued after Flush = %d, want 0", n)
+	}
+	pending := b.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("Pending = %d invalidations, want the paths split in two", len(pending))
+	}
+	var submitted []string
+	for _, inv := range pending {
+		if inv.Status != "InProgress" {
+			t.Errorf("invalidation %s is %s, want InProgress", inv.ID, inv.Status)
+		}
+		submitted = append(submitted, invalidator.Paths(inv.ID)...)
+	}
+	slices.Sort(submitted)
+	if !slices.Equal(submitted, paths) {
+		t.Errorf("submitted %d paths, want each of the %d queued once", len(submitted), len(paths))
+	}
+
+	// The fake reports InProgress once, then Completed.
+	b.poll(ctx)
+	if pending := b.Pending(); len(pending) != 2 {
+		t.Errorf("Pending after one poll = %+v, want both still in progress", pending)
+	}
+	b.poll(ctx)
+	if pending := b.Pending(); len(pending) != 0 {
+		t.Errorf("Pending after completion = %+v, want none", pending)
+	}
+}
+
+func TestBatcherFlushFailure(t *testing.T) {
+	ctx := context.Background()
+	invalidator := &flakyInvalidator{FakeInvalidator: NewFakeInvalidator(), down: true}
+	b := NewBatcher(invalidator, 0)
+
+	b.Enqueue("/videos/a.mp4", "/videos/b.mp4")
+	b.Flush(ctx)
+	if n := b.Queued(); n != 2 {
+		t.Errorf("Queued after a failed flush = %d, want both paths requeued", n)
+	}
+	pending := b.Pending()
+	if len(pending) != 1 || pending[0].Status != "Failed" || pending[0].Error == "" {
+		t.Fatalf("Pending = %+v, want the failed submission", pending)
+	}
+
+	invalidator.setDown(false)
+	b.Enqueue("/videos/c.mp4")
+	b.Flush(ctx)
+	if n := b.Queued(); n != 0 {
+		t.Errorf("Queued after recovering = %d, want 0", n)
+	}
+	pending = b.Pending()
+	if len(pending) != 1 || pending[0].Status != "InProgress" {
+		t.Fatalf("Pending after recovering = %+v, want only the new invalidation", pending)
+	}
+	want := []string{"/videos/a.mp4", "/videos/b.mp4", "/videos/c.mp4"}
+	if got := invalidator.Paths(pending[0].ID); !slices.Equal(got, want) {
+		t.Errorf("submitted %q, want the requeued paths with the new one", got)
+	}
+}
+
+func TestBatcherFailedCap(t *testing.T) {
+	ctx := context.Background()
+	invalidator := &flakyInvalidator{FakeInvalidator: NewFakeInvalidator(), down: true}
+	b := NewBatcher(invalidator, 0)
+
+	for i := range maxFailed + 5 {
+		b.Enqueue(fmt.Sprintf("/videos/%d.mp4", i))
+		b.Flush(ctx)
+	}
+	pending := b.Pending()
+	if len(pending) != maxFailed {
+		t.Fatalf("Pending = %d failures, want the last %d", len(pending), maxFailed)
+	}
+	// Each flush resubmits everything queued so far, so the latest failure
+	// carries every path.
+	if last := pending[len(pending)-1]; len(last.Paths) != maxFailed+5 {
+		t.Errorf("latest failure has %d paths, want %d", len(last.Paths), maxFailed+5)
+	}
+	if n := b.Queued(); n != maxFailed+5 {
+		t.Errorf("Queued = %d, want every path still queued", n)
+	}
+}
@@ -0,0 +1,107 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+const StatusCompleted = "Completed"
+
+// Invalidator submits cache invalidations to a CDN and reports on their
+// progress.
+type Invalidator interface {
+	CreateInvalidation(ctx context.Context, paths []string) (string, error)
+	InvalidationStatus(ctx context.Context, id string) (string, error)
+}
+
+type CloudFrontInvalidator struct {
+	client         *cloudfront.Client
+	distributionID string
+}
+
+func NewCloudFrontInvalidator(client *cloudfront.Client, distributionID string) *CloudFrontInvalidator {
+	return &CloudFrontInvalidator{
+		client:         client,
+		distributionID: distributionID,
+	}
+}
+
+func (i *CloudFrontInvalidator) CreateInvalidation(ctx context.Context, paths []string) (string, error) {
+	out, err := i.client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(i.distributionID),
+		InvalidationBatch: &types.InvalidationBatch{
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &types.Paths{
+				Quantity: aws.Int32(int32(len(paths))),
+				Items:    paths,
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't create CloudFront invalidation: %w", err)
+	}
+	return aws.ToString(out.Invalidation.Id), nil
+}
+
+func (i *CloudFrontInvalidator) InvalidationStatus(ctx context.Context, id string) (string, error) {
+	out, err := i.client.GetInvalidation(ctx, &cloudfront.GetInvalidationInput{
+		DistributionId: aws.String(i.distributionID),
+		Id:             aws.String(id),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't get CloudFront invalidation %s: %w", id, err)
+	}
+	return aws.ToString(out.Invalidation.Status), nil
+}
+
+// FakeInvalidator stands in for a CDN during local development. Invalidations
+// report InProgress once and complete on the next status check.
+type FakeInvalidator struct {
+	mu      sync.Mutex
+	nextID  int
+	batches map[string][]string
+	checked map[string]bool
+}
+
+func NewFakeInvalidator() *FakeInvalidator {
+	return &FakeInvalidator{
+		batches: map[string][]string{},
+		checked: map[string]bool{},
+	}
+}
+
+func (f *FakeInvalidator) CreateInvalidation(ctx context.Context, paths []string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("FAKE%d", f.nextID)
+	f.batches[id] = append([]string(nil), paths...)
+	return id, nil
+}
+
+func (f *FakeInvalidator) InvalidationStatus(ctx context.Context, id string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.batches[id]; !ok {
+		return "", fmt.Errorf("unknown invalidation %s", id)
+	}
+	if f.checked[id] {
+		return StatusCompleted, nil
+	}
+	f.checked[id] = true
+	return "InProgress", nil
+}
+
+// Paths returns the paths submitted with an invalidation.
+func (f *FakeInvalidator) Paths(id string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.batches[id]...)
+}
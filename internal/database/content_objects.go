@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ContentObject struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	RefCount  int       `json:"ref_count"`
+	CreateContentObjectParams
+}
+
+type CreateContentObjectParams struct {
+	Hash        string `json:"hash"`
+	ObjectKey   string `json:"object_key"`
+	SizeBytes   int64  `json:"size_bytes"`
+	ContentType string `json:"content_type"`
+	// OwnerID limits sharing the object to uploads by that user. Objects
+	// without one are shared by every upload of the same content.
+	OwnerID *uuid.UUID `json:"owner_id"`
+	// EncryptionKeyID and WrappedDataKey are set for objects stored
+	// encrypted: the data key, wrapped by the named master key.
+	EncryptionKeyID *string `json:"encryption_key_id"`
+	WrappedDataKey  *string `json:"-"`
+}
+
+const contentObjectColumns = `
+	hash,
+	owner_id,
+	created_at,
+	updated_at,
+	object_key,
+	size_bytes,
+	content_type,
+	ref_count,
+	encryption_key_id,
+	wrapped_data_key
+`
+
+func scanContentObject(row rowScanner) (ContentObject, error) {
+	var obj ContentObject
+	var ownerID string
+	err := row.Scan(
+		&obj.Hash,
+		&ownerID,
+		&obj.CreatedAt,
+		&obj.UpdatedAt,
+		&obj.ObjectKey,
+		&obj.SizeBytes,
+		&obj.ContentType,
+		&obj.RefCount,
+		&obj.EncryptionKeyID,
+		&obj.WrappedDataKey,
+	)
+	if err != nil || ownerID == "" {
+		return obj, err
+	}
+	owner, err := uuid.Parse(ownerID)
+	if err != nil {
+		return ContentObject{}, err
+	}
+	obj.OwnerID = &owner
+	return obj, nil
+}
+
+// contentObjectOwner is the owner_id stored for objects owned by owner: ”
+// for shared objects, which a primary key can't leave NULL.
+func contentObjectOwner(owner *uuid.UUID) string {
+	if owner == nil {
+		return ""
+	}
+	return owner.String()
+}
+
+// GetContentObject returns the object stored with the hash for owner, or
+// the shared one if owner is nil.
+func (c Client) GetContentObject(ctx context.Context, hash string, owner *uuid.UUID) (ContentObject, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + contentObjectColumns + `
+	FROM content_objects
+	WHERE hash = ? AND owner_id = ?
+	`
+	obj, err := scanContentObject(c.db.QueryRowContext(ctx, query, hash, contentObjectOwner(owner)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ContentObject{}, nil
+		}
+		return ContentObject{}, err
+	}
+	return obj, nil
+}
+
+func (c Client) GetContentObjectByKey(ctx context.Context, objectKey string) (ContentObject, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + contentObjectColumns + `
+	FROM content_objects
+	WHERE object_key = ?
+	`
+	obj, err := scanContentObject(c.db.QueryRowContext(ctx, query, objectKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ContentObject{}, nil
+		}
+		return ContentObject{}, err
+	}
+	return obj, nil
+}
+
+// AcquireContentObject adds a reference to an existing object. It reports
+// false if owner has no object with the hash, e.g. because the last
+// reference was released in the meantime.
+func (c Client) AcquireContentObject(ctx context.Context, hash string, owner *uuid.UUID) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	UPDATE content_objects
+	SET ref_count = ref_count + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE hash = ? AND owner_id = ?
+	`
+	result, err := c.db.ExecContext(ctx, query, hash, contentObjectOwner(owner))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CreateContentObject records a freshly stored object with one reference. If
+// another upload stored the same content for the same owner first, that row
+// wins and gains the reference instead; callers should compare the returned
+// ObjectKey with their own and discard their copy when they differ.
+func (c Client) CreateContentObject(ctx context.Context, params CreateContentObjectParams) (ContentObject, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	INSERT INTO content_objects (
+		hash,
+		owner_id,
+		created_at,
+		updated_at,
+		object_key,
+		size_bytes,
+		content_type,
+		ref_count,
+		encryption_key_id,
+		wrapped_data_key
+	) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, 1, ?, ?)
+	ON CONFLICT(hash, owner_id) DO UPDATE SET
+		ref_count = content_objects.ref_count + 1,
+		updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := c.db.ExecContext(ctx, query,
+		params.Hash,
+		contentObjectOwner(params.OwnerID),
+		params.ObjectKey,
+		params.SizeBytes,
+		params.ContentType,
+		params.EncryptionKeyID,
+		params.WrappedDataKey,
+	)
+	if err != nil {
+		return ContentObject{}, err
+	}
+	return c.GetContentObject(ctx, params.Hash, params.OwnerID)
+}
+
+// ReleaseContentObject drops one reference to the object stored under key and
+// returns how many remain. Objects that were never tracked report zero so
+// their single owner can delete them.
+func (c Client) ReleaseContentObject(ctx context.Context, objectKey string) (int, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	UPDATE content_objects
+	SET ref_count = ref_count - 1, updated_at = CURRENT_TIMESTAMP
+	WHERE object_key = ?
+	RETURNING ref_count
+	`
+	var remaining int
+	err := c.withTx(ctx, func(tx Client) error {
+		err := tx.db.QueryRowContext(ctx, query, objectKey).Scan(&remaining)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				remaining = 0
+				return nil
+			}
+			return err
+		}
+		if remaining > 0 {
+			return nil
+		}
+		_, err = tx.db.ExecContext(ctx, "DELETE FROM content_objects WHERE object_key = ? AND ref_count <= 0", objectKey)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return remaining, nil
+}
+
+// RenameObjectKey points every record of an object at its new key after the
+// object was copied there.
+func (c Client) RenameObjectKey(ctx context.Context, oldKey, newKey string) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.withTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, `
+		UPDATE content_objects
+		SET object_key = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE object_key = ?
+		`, newKey, oldKey)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, `
+		UPDATE video_versions
+		SET object_key = ?
+		WHERE object_key = ?
+		`, newKey, oldKey)
+		return err
+	})
+}
+
+// GetEncryptedContentObjects returns the objects whose data key is wrapped by
+// a master key other than keyID.
+func (c Client) GetEncryptedContentObjects(ctx context.Context, exceptKeyID string) ([]ContentObject, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + contentObjectColumns + `
+	FROM content_objects
+	WHERE encryption_key_id IS NOT NULL AND encryption_key_id != ?
+	ORDER BY created_at
+	`
+	rows, err := c.db.QueryContext(ctx, query, exceptKeyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objs := []ContentObject{}
+	for rows.Next() {
+		obj, err := scanContentObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, rows.Err()
+}
+
+// RewrapContentObject replaces an object's wrapped data key after it was
+// re-wrapped with another master key, and points the videos playing it at
+// that key. It only applies if the key is still wrapped by oldKeyID.
+func (c Client) RewrapContentObject(ctx context.Context, obj ContentObject, oldKeyID, keyID, wrappedDataKey string) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	var rewrapped bool
+	err := c.withTx(ctx, func(tx Client) error {
+		result, err := tx.db.ExecContext(ctx, `
+		UPDATE content_objects
+		SET encryption_key_id = ?, wrapped_data_key = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE hash = ? AND owner_id = ? AND encryption_key_id = ?
+		`, keyID, wrappedDataKey, obj.Hash, contentObjectOwner(obj.OwnerID), oldKeyID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		rewrapped = true
+		_, err = tx.db.ExecContext(ctx, `
+		UPDATE videos
+		SET encryption_key_id = ?
+		WHERE video_url = ? AND encryption_key_id IS NOT NULL
+		`, keyID, obj.ObjectKey)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return rewrapped, nil
+}
@@ -1,31 +1,130 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	// db is conn, or the transaction when the Client came from withTx.
+	db           querier
+	conn         conn
+	queryTimeout time.Duration
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
-	if err != nil {
-		return Client{}, err
+// Options tunes the connection pool and query limits. Zero values keep the
+// database/sql and driver defaults.
+type Options struct {
+	// QueryTimeout bounds each Client call on top of the caller's context.
+	// Migrations aren't bounded by it.
+	QueryTimeout    time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// SQLiteJournalMode (such as "WAL") and SQLiteBusyTimeout are set on
+	// every SQLite connection and ignored for PostgreSQL.
+	SQLiteJournalMode string
+	SQLiteBusyTimeout time.Duration
+}
+
+// NewClient connects to the database at dbURL: a postgres:// URL for
+// PostgreSQL, otherwise an SQLite file path.
+func NewClient(dbURL string, opts Options) (Client, error) {
+	dialect, driver, dsn := parseDatabaseURL(dbURL)
+	if dialect == dialectSQLite {
+		dsn = sqliteDSN(dsn, opts)
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	return c, nil
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns > 0 {
+		// Zero would disable idle connections rather than keep the default.
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	pool := conn{db: db, dialect: dialect}
+	return Client{
+		db:           pool,
+		conn:         pool,
+		queryTimeout: opts.QueryTimeout,
+	}, nil
+}
+
+// sqliteDSN adds the per-connection pragmas go-sqlite3 reads from the DSN.
+// Transactions begin IMMEDIATE, taking the write lock up front (waiting up to
+// the busy timeout) instead of failing when a read turns into a write.
+func sqliteDSN(dsn string, opts Options) string {
+	params := url.Values{"_txlock": {"immediate"}}
+	if opts.SQLiteJournalMode != "" {
+		params.Set("_journal_mode", opts.SQLiteJournalMode)
+	}
+	if opts.SQLiteBusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(opts.SQLiteBusyTimeout.Milliseconds(), 10))
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + params.Encode()
+}
 
+// queryContext bounds a Client call by the configured query timeout.
+func (c Client) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.queryTimeout)
 }
 
-func (c *Client) autoMigrate() error {
+// bootstrapLegacySchema adopts an SQLite database created before migrations
+// were versioned: it brings the tables up to the baseline migration with the
+// old additive upgrades and records the baseline as applied.
+func (c Client) bootstrapLegacySchema(ctx context.Context) error {
+	if c.conn.dialect != dialectSQLite {
+		return nil
+	}
+	var applied int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if err != nil || applied > 0 {
+		return err
+	}
+	var legacyTables int
+	err = c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&legacyTables)
+	if err != nil || legacyTables == 0 {
+		return err
+	}
+
+	err = c.upgradeLegacySchema(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't bring legacy schema up to the baseline: %w", err)
+	}
+	migrations, err := loadMigrations(c.conn.dialect)
+	if err != nil {
+		return err
+	}
+	baseline := migrations[0]
+	_, err = c.db.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		baseline.Version, baseline.Name, baseline.Checksum, time.Now().UTC(),
+	)
+	return err
+}
+
+// upgradeLegacySchema is the schema setup that ran on every start before
+// migrations were versioned. It only runs for databases it created.
+func (c *Client) upgradeLegacySchema(ctx context.Context) error {
 	userTable := `
 	CREATE TABLE IF NOT EXISTS users (
 		id TEXT PRIMARY KEY,
@@ -35,7 +134,7 @@ func (c *Client) autoMigrate() error {
 		email TEXT UNIQUE NOT NULL
 	);
 	`
-	_, err := c.db.Exec(userTable)
+	_, err := c.db.ExecContext(ctx, userTable)
 	if err != nil {
 		return err
 	}
@@ -50,7 +149,7 @@ func (c *Client) autoMigrate() error {
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
-	_, err = c.db.Exec(refreshTokenTable)
+	_, err = c.db.ExecContext(ctx, refreshTokenTable)
 	if err != nil {
 		return err
 	}
@@ -68,22 +167,150 @@ func (c *Client) autoMigrate() error {
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
-	_, err = c.db.Exec(videoTable)
+	_, err = c.db.ExecContext(ctx, videoTable)
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "videos", "current_version", "INTEGER")
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "users", "video_version_limit", "INTEGER")
+	if err != nil {
+		return err
+	}
+
+	videoVersionTable := `
+	CREATE TABLE IF NOT EXISTS video_versions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		object_key TEXT NOT NULL,
+		size_bytes INTEGER NOT NULL,
+		content_type TEXT NOT NULL,
+		aspect_ratio TEXT NOT NULL,
+		uploaded_by TEXT NOT NULL,
+		UNIQUE(video_id, version),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(uploaded_by) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.ExecContext(ctx, videoVersionTable)
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "video_versions", "checksum_sha256", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "videos", "video_checksum_sha256", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	contentObjectTable := `
+	CREATE TABLE IF NOT EXISTS content_objects (
+		hash TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		object_key TEXT UNIQUE NOT NULL,
+		size_bytes INTEGER NOT NULL,
+		content_type TEXT NOT NULL,
+		ref_count INTEGER NOT NULL
+	);
+	`
+	_, err = c.db.ExecContext(ctx, contentObjectTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.addColumnIfMissing(ctx, "users", "quota_bytes", "INTEGER")
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "users", "quota_videos", "INTEGER")
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "users", "storage_used_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	usageAdded, err := c.addColumnIfMissing(ctx, "users", "video_count", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	if usageAdded {
+		err = c.RecalculateUsage(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.addColumnIfMissing(ctx, "content_objects", "encryption_key_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "content_objects", "wrapped_data_key", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.addColumnIfMissing(ctx, "videos", "encryption_key_id", "TEXT")
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
+// addColumnIfMissing lets upgradeLegacySchema grow tables that already exist, since
+// CREATE TABLE IF NOT EXISTS leaves their columns untouched.
+func (c *Client) addColumnIfMissing(ctx context.Context, table, column, definition string) (bool, error) {
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	if err := rows.Err(); err != nil {
+		return false, err
 	}
-	return nil
+	rows.Close()
+
+	_, err = c.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return false, fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return true, nil
+}
+
+func (c Client) Reset(ctx context.Context) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.withTx(ctx, func(tx Client) error {
+		// Children first, so foreign keys hold on engines that enforce them.
+		for _, table := range []string{"refresh_tokens", "video_versions", "content_objects", "video_tags", "tags", "videos", "users"} {
+			if _, err := tx.db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+				return fmt.Errorf("failed to reset table %s: %w", table, err)
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// dialect covers what differs between the engines the Client supports.
+// Queries are written once with "?" placeholders and portable SQL; each
+// engine gets its own migrations for the schema.
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
+)
+
+// parseDatabaseURL picks the engine from the URL scheme. Anything that isn't
+// a postgres:// URL is taken as an SQLite path, optionally written as
+// sqlite://path.
+func parseDatabaseURL(dbURL string) (dialect, string, string) {
+	switch {
+	case strings.HasPrefix(dbURL, "postgres://"), strings.HasPrefix(dbURL, "postgresql://"):
+		return dialectPostgres, "postgres", dbURL
+	case strings.HasPrefix(dbURL, "sqlite://"):
+		return dialectSQLite, "sqlite3", strings.TrimPrefix(dbURL, "sqlite://")
+	default:
+		return dialectSQLite, "sqlite3", dbURL
+	}
+}
+
+// rebind rewrites "?" placeholders to Postgres' "$1", "$2", ... leaving
+// question marks inside string literals and quoted identifiers alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// conn is the *sql.DB a Client queries through. It only offers the
+// context-taking calls, and rebinds placeholders for its dialect.
+type conn struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.db.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.db.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) BeginTx(ctx context.Context) (*tx, error) {
+	sqlTx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{tx: sqlTx, dialect: c.dialect}, nil
+}
+
+type tx struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (t *tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *tx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -0,0 +1,905 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrEmailTaken = errors.New("email is already registered")
+
+// MemoryStore keeps everything the handlers store in memory, for tests that
+// exercise them without a database file. It is safe for concurrent use.
+// Transactions roll back on error but aren't isolated from each other.
+type MemoryStore struct {
+	mu sync.Mutex
+	memoryTables
+}
+
+type memoryTables struct {
+	users          map[uuid.UUID]User
+	usage          map[uuid.UUID]UserUsage
+	versionLimits  map[uuid.UUID]int
+	videos         map[uuid.UUID]Video
+	versions       map[uuid.UUID]VideoVersion
+	contentObjects map[contentObjectID]ContentObject
+	refreshTokens  map[string]RefreshToken
+}
+
+// contentObjectID is the primary key of content_objects, with uuid.Nil
+// standing in for shared objects.
+type contentObjectID struct {
+	hash  string
+	owner uuid.UUID
+}
+
+func newContentObjectID(hash string, owner *uuid.UUID) contentObjectID {
+	id := contentObjectID{hash: hash}
+	if owner != nil {
+		id.owner = *owner
+	}
+	return id
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryTables: newMemoryTables()}
+}
+
+func newMemoryTables() memoryTables {
+	return memoryTables{
+		users:          map[uuid.UUID]User{},
+		usage:          map[uuid.UUID]UserUsage{},
+		versionLimits:  map[uuid.UUID]int{},
+		videos:         map[uuid.UUID]Video{},
+		versions:       map[uuid.UUID]VideoVersion{},
+		contentObjects: map[contentObjectID]ContentObject{},
+		refreshTokens:  map[string]RefreshToken{},
+	}
+}
+
+func (t memoryTables) clone() memoryTables {
+	return memoryTables{
+		users:          maps.Clone(t.users),
+		usage:          maps.Clone(t.usage),
+		versionLimits:  maps.Clone(t.versionLimits),
+		videos:         maps.Clone(t.videos),
+		versions:       maps.Clone(t.versions),
+		contentObjects: maps.Clone(t.contentObjects),
+		refreshTokens:  maps.Clone(t.refreshTokens),
+	}
+}
+
+// WithTx runs fn against the store itself and, if fn fails, puts back
+// everything as it was before.
+func (m *MemoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	m.mu.Lock()
+	saved := m.memoryTables.clone()
+	m.mu.Unlock()
+
+	err := fn(m)
+	if err != nil {
+		m.mu.Lock()
+		m.memoryTables = saved
+		m.mu.Unlock()
+	}
+	return err
+}
+
+func (m *MemoryStore) Reset(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.memoryTables = newMemoryTables()
+	return nil
+}
+
+func (m *MemoryStore) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Email == params.Email {
+			return nil, ErrEmailTaken
+		}
+	}
+	created := timestamp()
+	user := User{
+		ID:               uuid.New(),
+		CreatedAt:        created,
+		UpdatedAt:        created,
+		CreateUserParams: params,
+	}
+	m.users[user.ID] = user
+	m.usage[user.ID] = UserUsage{UserID: user.ID}
+	return &user, nil
+}
+
+func (m *MemoryStore) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (m *MemoryStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, nil
+}
+
+func (m *MemoryStore) GetUserVideoVersionLimit(ctx context.Context, id uuid.UUID) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit, ok := m.versionLimits[id]
+	if !ok {
+		return nil, nil
+	}
+	return &limit, nil
+}
+
+func (m *MemoryStore) SetUserVideoVersionLimit(ctx context.Context, id uuid.UUID, limit *int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return nil
+	}
+	if limit == nil {
+		delete(m.versionLimits, id)
+	} else {
+		m.versionLimits[id] = *limit
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetUserUsage(ctx context.Context, userID uuid.UUID) (UserUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.usage[userID], nil
+}
+
+// SetUserQuota is Client.SetUserQuota, for tests that need a quota other
+// than the defaults.
+func (m *MemoryStore) SetUserQuota(ctx context.Context, userID uuid.UUID, quotaBytes *int64, quotaVideos *int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.usage[userID]
+	if !ok {
+		return nil
+	}
+	usage.QuotaBytes = quotaBytes
+	usage.QuotaVideos = quotaVideos
+	m.usage[userID] = usage
+	return nil
+}
+
+func (m *MemoryStore) ReserveUserStorage(ctx context.Context, userID uuid.UUID, bytes, quotaBytes int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.usage[userID]
+	if !ok || quotaBytes > 0 && usage.StorageUsedBytes+bytes > quotaBytes {
+		return false, nil
+	}
+	usage.StorageUsedBytes += bytes
+	m.usage[userID] = usage
+	return true, nil
+}
+
+func (m *MemoryStore) ReserveUserVideo(ctx context.Context, userID uuid.UUID, quotaVideos int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.usage[userID]
+	if !ok || quotaVideos > 0 && usage.VideoCount+1 > quotaVideos {
+		return false, nil
+	}
+	usage.VideoCount++
+	m.usage[userID] = usage
+	return true, nil
+}
+
+func (m *MemoryStore) AddUserStorageUsage(ctx context.Context, userID uuid.UUID, delta int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.usage[userID]
+	if !ok {
+		return nil
+	}
+	usage.StorageUsedBytes = max(usage.StorageUsedBytes+delta, 0)
+	m.usage[userID] = usage
+	return nil
+}
+
+func (m *MemoryStore) AddUserVideoCount(ctx context.Context, userID uuid.UUID, delta int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.usage[userID]
+	if !ok {
+		return nil
+	}
+	usage.VideoCount = max(usage.VideoCount+delta, 0)
+	m.usage[userID] = usage
+	return nil
+}
+
+func (m *MemoryStore) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created := timestamp()
+	video := Video{
+		ID:                uuid.New(),
+		CreatedAt:         created,
+		UpdatedAt:         created,
+		CreateVideoParams: params,
+	}
+	video.Tags = sortedTags(params.Tags)
+	m.videos[video.ID] = video
+	return video, nil
+}
+
+func (m *MemoryStore) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video := m.videos[id]
+	if video.DeletedAt != nil {
+		return Video{}, nil
+	}
+	return video, nil
+}
+
+func (m *MemoryStore) ListVideos(ctx context.Context, params ListVideosParams) ([]Video, *VideoCursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := videoSortColumns[params.Sort]; !ok {
+		return nil, nil, fmt.Errorf("unknown sort %q", params.Sort)
+	}
+	if params.Cursor != nil && (params.Cursor.Sort != params.Sort || params.Cursor.Descending != params.Descending) {
+		return nil, nil, fmt.Errorf("%w: it belongs to a listing with a different sort", ErrInvalidCursor)
+	}
+
+	// before reports whether a comes before b in the listing's order.
+	before := func(a, b Video) bool {
+		cmp := compareVideos(params.Sort, a, b)
+		if cmp == 0 {
+			cmp = strings.Compare(a.ID.String(), b.ID.String())
+		}
+		if params.Descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+
+	videos := []Video{}
+	for _, video := range m.videos {
+		if video.UserID != params.UserID || video.DeletedAt != nil ||
+			params.HasVideo != nil && (video.VideoURL != nil) != *params.HasVideo ||
+			params.HasThumbnail != nil && (video.ThumbnailURL != nil) != *params.HasThumbnail ||
+			params.Orientation != nil && (video.Orientation == nil || *video.Orientation != *params.Orientation) ||
+			params.CreatedAfter != nil && video.CreatedAt.Before(*params.CreatedAfter) ||
+			params.CreatedBefore != nil && !video.CreatedAt.Before(*params.CreatedBefore) ||
+			len(params.Tags) > 0 && !hasTags(video, params.Tags, params.MatchAllTags) {
+			continue
+		}
+		if params.Cursor != nil && !before(videoAtCursor(*params.Cursor), video) {
+			continue
+		}
+		videos = append(videos, video)
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return before(videos[i], videos[j])
+	})
+	return pageOfVideos(params, videos)
+}
+
+// SearchVideos matches the way Client does on SQLite without FTS5: every
+// word must appear somewhere in the title or description, and title matches
+// score higher.
+func (m *MemoryStore) SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := []VideoSearchResult{}
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+	for _, video := range m.videos {
+		if video.UserID != params.UserID || video.DeletedAt != nil {
+			continue
+		}
+		title := strings.ToLower(video.Title)
+		description := ""
+		if video.Description != nil {
+			description = *video.Description
+		}
+		lowerDescription := strings.ToLower(description)
+		score := 0.0
+		matched := true
+		for _, term := range terms {
+			term = strings.ToLower(term)
+			inTitle := strings.Contains(title, term)
+			inDescription := strings.Contains(lowerDescription, term)
+			if !inTitle && !inDescription {
+				matched = false
+				break
+			}
+			if inTitle {
+				score += 10
+			}
+			if inDescription {
+				score++
+			}
+		}
+		if !matched {
+			continue
+		}
+		results = append(results, VideoSearchResult{
+			Video:              video,
+			Score:              score,
+			TitleHighlight:     markMatches(highlightTerms(video.Title, terms)),
+			DescriptionSnippet: markMatches(highlightTerms(snippetAround(description, terms), terms)),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Video.ID.String() < results[j].Video.ID.String()
+	})
+	start := min(params.Offset, len(results))
+	end := min(start+params.Limit, len(results))
+	return results[start:end], nil
+}
+
+// compareVideos orders two videos by a sort's value alone.
+func compareVideos(by VideoSort, a, b Video) int {
+	switch by {
+	case VideoSortUpdated:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case VideoSortTitle:
+		return strings.Compare(a.Title, b.Title)
+	case VideoSortDuration:
+		return cmp.Compare(videoDuration(a), videoDuration(b))
+	default:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+}
+
+// videoAtCursor is a stand-in video holding the cursor's position.
+func videoAtCursor(vc VideoCursor) Video {
+	video := Video{ID: vc.ID}
+	value, _ := vc.sortValue()
+	switch v := value.(type) {
+	case time.Time:
+		video.CreatedAt, video.UpdatedAt = v, v
+	case string:
+		video.Title = v
+	case float64:
+		video.DurationSeconds = &v
+	}
+	return video
+}
+
+// UpdateVideo overwrites the stored video but its creation time, tags and
+// trash state, and bumps its update time like Client.UpdateVideo does.
+// Updating a missing video is a no-op.
+func (m *MemoryStore) UpdateVideo(ctx context.Context, video Video) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.videos[video.ID]
+	if !ok {
+		return nil
+	}
+	video.CreatedAt = existing.CreatedAt
+	video.UpdatedAt = timestamp()
+	video.Tags = existing.Tags
+	video.DeletedAt = existing.DeletedAt
+	m.videos[video.ID] = video
+	return nil
+}
+
+// UpdateVideoIfUnchanged is UpdateVideo for a video read at its UpdatedAt,
+// returning ErrVideoModified if it has been updated or deleted since.
+func (m *MemoryStore) UpdateVideoIfUnchanged(ctx context.Context, video Video) error {
+	m.mu.Lock()
+	existing, ok := m.videos[video.ID]
+	m.mu.Unlock()
+	if !ok || !existing.UpdatedAt.Equal(video.UpdatedAt) {
+		return ErrVideoModified
+	}
+	return m.UpdateVideo(ctx, video)
+}
+
+func (m *MemoryStore) SetVideoURLIfUnchanged(ctx context.Context, id uuid.UUID, oldURL, newURL string) (bool, error) {
+	return m.setVideoURLIfUnchanged(id, func(video *Video) **string { return &video.VideoURL }, oldURL, newURL), nil
+}
+
+func (m *MemoryStore) SetThumbnailURLIfUnchanged(ctx context.Context, id uuid.UUID, oldURL, newURL string) (bool, error) {
+	return m.setVideoURLIfUnchanged(id, func(video *Video) **string { return &video.ThumbnailURL }, oldURL, newURL), nil
+}
+
+// setVideoURLIfUnchanged sets the URL field picks out if it holds oldURL.
+func (m *MemoryStore) setVideoURLIfUnchanged(id uuid.UUID, field func(*Video) **string, oldURL, newURL string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	url := field(&video)
+	if !ok || *url == nil || **url != oldURL {
+		return false
+	}
+	*url = &newURL
+	video.UpdatedAt = timestamp()
+	m.videos[id] = video
+	return true
+}
+
+func (m *MemoryStore) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteVideo(id)
+	return nil
+}
+
+func (m *MemoryStore) DeleteTrashedVideo(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if video, ok := m.videos[id]; !ok || video.DeletedAt == nil {
+		return ErrVideoNotTrashed
+	}
+	m.deleteVideo(id)
+	return nil
+}
+
+// deleteVideo removes the video and its versions; its tags go with it.
+func (m *MemoryStore) deleteVideo(id uuid.UUID) {
+	for versionID, version := range m.versions {
+		if version.VideoID == id {
+			delete(m.versions, versionID)
+		}
+	}
+	delete(m.videos, id)
+}
+
+func (m *MemoryStore) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	if !ok || video.DeletedAt != nil {
+		return nil
+	}
+	deleted := timestamp()
+	video.DeletedAt = &deleted
+	video.UpdatedAt = deleted
+	m.videos[id] = video
+	return nil
+}
+
+func (m *MemoryStore) RestoreVideo(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	if !ok || video.UserID != userID || video.DeletedAt == nil {
+		return false, nil
+	}
+	video.DeletedAt = nil
+	video.UpdatedAt = timestamp()
+	m.videos[id] = video
+	return true, nil
+}
+
+func (m *MemoryStore) ListTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	videos := []Video{}
+	for _, video := range m.videos {
+		if video.UserID == userID && video.DeletedAt != nil {
+			videos = append(videos, video)
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		if !videos[i].DeletedAt.Equal(*videos[j].DeletedAt) {
+			return videos[i].DeletedAt.After(*videos[j].DeletedAt)
+		}
+		return videos[i].ID.String() < videos[j].ID.String()
+	})
+	return videos, nil
+}
+
+func (m *MemoryStore) ListVideosTrashedBefore(ctx context.Context, cutoff time.Time, after *Video, limit int) ([]Video, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// before reports whether a went to the trash before b, ties broken by ID
+	// like Client does.
+	before := func(a, b Video) bool {
+		if !a.DeletedAt.Equal(*b.DeletedAt) {
+			return a.DeletedAt.Before(*b.DeletedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	}
+	videos := []Video{}
+	for _, video := range m.videos {
+		if video.DeletedAt == nil || !video.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if after != nil && after.DeletedAt != nil && !before(*after, video) {
+			continue
+		}
+		videos = append(videos, video)
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return before(videos[i], videos[j])
+	})
+	return videos[:min(limit, len(videos))], nil
+}
+
+// GetAllVideos returns every video regardless of owner, including those in
+// the trash, oldest first.
+func (m *MemoryStore) GetAllVideos(ctx context.Context) ([]Video, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	videos := slices.Collect(maps.Values(m.videos))
+	sort.Slice(videos, func(i, j int) bool {
+		if !videos[i].CreatedAt.Equal(videos[j].CreatedAt) {
+			return videos[i].CreatedAt.Before(videos[j].CreatedAt)
+		}
+		return videos[i].ID.String() < videos[j].ID.String()
+	})
+	return videos, nil
+}
+
+func (m *MemoryStore) CreateVideoVersion(ctx context.Context, params CreateVideoVersionParams) (VideoVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number := 1
+	for _, version := range m.versions {
+		if version.VideoID == params.VideoID && version.Version >= number {
+			number = version.Version + 1
+		}
+	}
+	version := VideoVersion{
+		ID:                       uuid.New(),
+		CreatedAt:                timestamp(),
+		Version:                  number,
+		CreateVideoVersionParams: params,
+	}
+	m.versions[version.ID] = version
+	return version, nil
+}
+
+// GetVideoVersions returns the video's versions, newest first.
+func (m *MemoryStore) GetVideoVersions(ctx context.Context, videoID uuid.UUID) ([]VideoVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := []VideoVersion{}
+	for _, version := range m.versions {
+		if version.VideoID == videoID {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+	return versions, nil
+}
+
+func (m *MemoryStore) GetVideoVersion(ctx context.Context, videoID uuid.UUID, number int) (VideoVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, version := range m.versions {
+		if version.VideoID == videoID && version.Version == number {
+			return version, nil
+		}
+	}
+	return VideoVersion{}, nil
+}
+
+func (m *MemoryStore) DeleteVideoVersion(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.versions, id)
+	return nil
+}
+
+// GetAllVideoVersions returns the versions of every video, oldest first.
+func (m *MemoryStore) GetAllVideoVersions(ctx context.Context) ([]VideoVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := slices.Collect(maps.Values(m.versions))
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].CreatedAt.Equal(versions[j].CreatedAt) {
+			return versions[i].CreatedAt.Before(versions[j].CreatedAt)
+		}
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+func (m *MemoryStore) GetContentObject(ctx context.Context, hash string, owner *uuid.UUID) (ContentObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.contentObjects[newContentObjectID(hash, owner)], nil
+}
+
+func (m *MemoryStore) GetContentObjectByKey(ctx context.Context, objectKey string) (ContentObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, obj := range m.contentObjects {
+		if obj.ObjectKey == objectKey {
+			return obj, nil
+		}
+	}
+	return ContentObject{}, nil
+}
+
+func (m *MemoryStore) AcquireContentObject(ctx context.Context, hash string, owner *uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := newContentObjectID(hash, owner)
+	obj, ok := m.contentObjects[id]
+	if !ok {
+		return false, nil
+	}
+	obj.RefCount++
+	obj.UpdatedAt = timestamp()
+	m.contentObjects[id] = obj
+	return true, nil
+}
+
+// CreateContentObject records the object with one reference, or adds a
+// reference to the object already stored with the same hash for the owner.
+func (m *MemoryStore) CreateContentObject(ctx context.Context, params CreateContentObjectParams) (ContentObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := newContentObjectID(params.Hash, params.OwnerID)
+	obj, ok := m.contentObjects[id]
+	if ok {
+		obj.RefCount++
+		obj.UpdatedAt = timestamp()
+	} else {
+		created := timestamp()
+		obj = ContentObject{
+			CreatedAt:                 created,
+			UpdatedAt:                 created,
+			RefCount:                  1,
+			CreateContentObjectParams: params,
+		}
+	}
+	m.contentObjects[id] = obj
+	return obj, nil
+}
+
+// ReleaseContentObject drops one reference to the object stored under key,
+// forgetting it once none remain, and returns how many remain.
+func (m *MemoryStore) ReleaseContentObject(ctx context.Context, objectKey string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, obj := range m.contentObjects {
+		if obj.ObjectKey != objectKey {
+			continue
+		}
+		obj.RefCount--
+		if obj.RefCount <= 0 {
+			delete(m.contentObjects, id)
+			return 0, nil
+		}
+		obj.UpdatedAt = timestamp()
+		m.contentObjects[id] = obj
+		return obj.RefCount, nil
+	}
+	return 0, nil
+}
+
+func (m *MemoryStore) RenameObjectKey(ctx context.Context, oldKey, newKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, obj := range m.contentObjects {
+		if obj.ObjectKey == oldKey {
+			obj.ObjectKey = newKey
+			obj.UpdatedAt = timestamp()
+			m.contentObjects[id] = obj
+		}
+	}
+	for id, version := range m.versions {
+		if version.ObjectKey == oldKey {
+			version.ObjectKey = newKey
+			m.versions[id] = version
+		}
+	}
+	return nil
+}
+
+// GetEncryptedContentObjects returns the objects whose data key is wrapped by
+// a master key other than exceptKeyID, oldest first.
+func (m *MemoryStore) GetEncryptedContentObjects(ctx context.Context, exceptKeyID string) ([]ContentObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objs := []ContentObject{}
+	for _, obj := range m.contentObjects {
+		if obj.EncryptionKeyID != nil && *obj.EncryptionKeyID != exceptKeyID {
+			objs = append(objs, obj)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].CreatedAt.Before(objs[j].CreatedAt)
+	})
+	return objs, nil
+}
+
+// RewrapContentObject is Client.RewrapContentObject: it only applies if the
+// object's data key is still wrapped by oldKeyID.
+func (m *MemoryStore) RewrapContentObject(ctx context.Context, obj ContentObject, oldKeyID, keyID, wrappedDataKey string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := newContentObjectID(obj.Hash, obj.OwnerID)
+	stored, ok := m.contentObjects[id]
+	if !ok || stored.EncryptionKeyID == nil || *stored.EncryptionKeyID != oldKeyID {
+		return false, nil
+	}
+	stored.EncryptionKeyID = &keyID
+	stored.WrappedDataKey = &wrappedDataKey
+	stored.UpdatedAt = timestamp()
+	m.contentObjects[id] = stored
+	for id, video := range m.videos {
+		if video.VideoURL != nil && *video.VideoURL == obj.ObjectKey && video.EncryptionKeyID != nil {
+			video.EncryptionKeyID = &keyID
+			m.videos[id] = video
+		}
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) SetVideoTags(ctx context.Context, videoID uuid.UUID, names []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[videoID]
+	if !ok {
+		return nil
+	}
+	video.Tags = sortedTags(names)
+	video.UpdatedAt = timestamp()
+	m.videos[videoID] = video
+	return nil
+}
+
+func (m *MemoryStore) ListTags(ctx context.Context, userID uuid.UUID) ([]TagCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byName := map[string]int{}
+	for _, video := range m.videos {
+		if video.UserID != userID || video.DeletedAt != nil {
+			continue
+		}
+		for _, name := range video.Tags {
+			byName[name]++
+		}
+	}
+	counts := make([]TagCount, 0, len(byName))
+	for name, n := range byName {
+		counts = append(counts, TagCount{Name: name, VideoCount: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].VideoCount != counts[j].VideoCount {
+			return counts[i].VideoCount > counts[j].VideoCount
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts, nil
+}
+
+func sortedTags(names []string) []string {
+	tags := append([]string{}, names...)
+	sort.Strings(tags)
+	return tags
+}
+
+// hasTags reports whether the video carries any of the names, or all of
+// them when matchAll is set.
+func hasTags(video Video, names []string, matchAll bool) bool {
+	matched := 0
+	for _, name := range names {
+		if slices.Contains(video.Tags, name) {
+			matched++
+		}
+	}
+	if matchAll {
+		return matched == len(names)
+	}
+	return matched > 0
+}
+
+func (m *MemoryStore) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created := timestamp()
+	rt := RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                created,
+		UpdatedAt:                created,
+	}
+	m.refreshTokens[rt.Token] = rt
+	return rt, nil
+}
+
+// GetUserByRefreshToken returns the token's owner whether or not the token
+// is revoked or expired; checking that is up to the caller.
+func (m *MemoryStore) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rt, ok := m.refreshTokens[token]
+	if !ok {
+		return nil, nil
+	}
+	user, ok := m.users[rt.UserID]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (m *MemoryStore) RevokeRefreshToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rt, ok := m.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+	revoked := timestamp()
+	rt.RevokedAt = &revoked
+	m.refreshTokens[token] = rt
+	return nil
+}
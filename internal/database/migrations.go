@@ -0,0 +1,365 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// Migration is one schema change, read from
+// migrations/<dialect>/NNNN_name.up.sql and its matching .down.sql. Both
+// dialects keep the same version numbers.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+	// Unsupported marks a pending migration this build can't run: the
+	// SQLite search index in a build without FTS5. It stays pending, and
+	// doesn't hold back the migrations after it, until a build with FTS5
+	// applies it.
+	Unsupported bool
+}
+
+var (
+	ErrMigrationLocked   = errors.New("another process is migrating the database")
+	ErrMigrationsPending = errors.New("database schema has pending migrations")
+)
+
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const (
+	migrationLockTimeout = 30 * time.Second
+	migrationLockPoll    = 500 * time.Millisecond
+)
+
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/" + string(d)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (c Client) ensureMigrationTables(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		locked_by TEXT NOT NULL,
+		locked_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// lockMigrations takes the migration lock, waiting for another instance to
+// finish. The lock is a row rather than a transaction, so it works the same
+// across database engines and survives the schema changes it protects.
+func (c Client) lockMigrations(ctx context.Context) (func(), error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	deadline := time.Now().Add(migrationLockTimeout)
+	for {
+		_, err := c.db.ExecContext(ctx,
+			"INSERT INTO schema_migrations_lock (id, locked_by, locked_at) VALUES (1, ?, ?)",
+			owner, time.Now().UTC(),
+		)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			var lockedBy string
+			if c.db.QueryRowContext(ctx, "SELECT locked_by FROM schema_migrations_lock WHERE id = 1").Scan(&lockedBy) != nil {
+				return nil, fmt.Errorf("couldn't take migration lock: %w", err)
+			}
+			return nil, fmt.Errorf("%w (%s); if it died, run `migrate unlock`", ErrMigrationLocked, lockedBy)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(migrationLockPoll):
+		}
+	}
+	return func() {
+		// Release the lock even if ctx was cancelled mid-migration.
+		c.db.ExecContext(context.WithoutCancel(ctx), "DELETE FROM schema_migrations_lock WHERE id = 1 AND locked_by = ?", owner)
+	}, nil
+}
+
+// ForceUnlockMigrations releases a lock left behind by a process that died
+// while migrating.
+func (c Client) ForceUnlockMigrations(ctx context.Context) error {
+	if err := c.ensureMigrationTables(ctx); err != nil {
+		return err
+	}
+	_, err := c.db.ExecContext(ctx, "DELETE FROM schema_migrations_lock")
+	return err
+}
+
+func (c Client) appliedMigrations(ctx context.Context) (map[int]MigrationStatus, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &status.Checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	return applied, rows.Err()
+}
+
+// createsSearchIndex reports whether m creates the SQLite FTS5 search
+// index. Builds without FTS5 leave it pending, and search falls back to
+// LIKE.
+func (c Client) createsSearchIndex(m Migration) bool {
+	return c.conn.dialect == dialectSQLite && strings.Contains(m.Up, "USING fts5")
+}
+
+// checkSearchIndex fails if the database has an FTS5 index this build can't
+// keep up to date: its triggers would fail every write to videos.
+func (c Client) checkSearchIndex(ctx context.Context) error {
+	if c.conn.dialect != dialectSQLite || sqliteFTS5 {
+		return nil
+	}
+	indexed, err := c.hasSearchIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if indexed {
+		return errors.New("database has an FTS5 search index: build with -tags sqlite_fts5 to use it")
+	}
+	return nil
+}
+
+// MigrationStatus lists every known migration and when it was applied. It
+// fails if an applied migration was edited afterwards or is missing from
+// this build.
+func (c Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	if err := c.ensureMigrationTables(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.checkSearchIndex(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.conn.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			if a.Checksum != m.Checksum {
+				return nil, fmt.Errorf("migration %04d_%s was changed after it was applied", m.Version, m.Name)
+			}
+			status.AppliedAt = a.AppliedAt
+			delete(applied, m.Version)
+		}
+		if c.createsSearchIndex(m) {
+			// Older builds without FTS5 recorded the index as applied
+			// without creating it; such a record counts as pending.
+			if status.AppliedAt != nil {
+				indexed, err := c.hasSearchIndex(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if !indexed {
+					status.AppliedAt = nil
+				}
+			}
+			status.Unsupported = status.AppliedAt == nil && !sqliteFTS5
+		}
+		statuses = append(statuses, status)
+	}
+	for version, a := range applied {
+		return nil, fmt.Errorf("migration %04d_%s is applied but unknown to this build", version, a.Name)
+	}
+	return statuses, nil
+}
+
+// CheckMigrations returns ErrMigrationsPending if the schema is behind in a
+// way this build could fix.
+func (c Client) CheckMigrations(ctx context.Context) error {
+	statuses, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil && !status.Unsupported {
+			return fmt.Errorf("%w, starting with %04d_%s", ErrMigrationsPending, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration this build supports in order,
+// each in its own transaction, and returns the ones it applied.
+func (c Client) MigrateUp(ctx context.Context) ([]Migration, error) {
+	if err := c.ensureMigrationTables(ctx); err != nil {
+		return nil, err
+	}
+	unlock, err := c.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := c.bootstrapLegacySchema(ctx); err != nil {
+		return nil, err
+	}
+	statuses, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, status := range statuses {
+		if status.AppliedAt != nil || status.Unsupported {
+			continue
+		}
+		err := c.runMigration(ctx, status.Migration, status.Up, func(tx *tx) error {
+			// Replaces the record an older build left for a search index
+			// it skipped.
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", status.Version)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				status.Version, status.Name, status.Checksum, time.Now().UTC(),
+			)
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first.
+func (c Client) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	if err := c.ensureMigrationTables(ctx); err != nil {
+		return nil, err
+	}
+	unlock, err := c.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	statuses, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		status := statuses[i]
+		if status.AppliedAt == nil {
+			continue
+		}
+		err := c.runMigration(ctx, status.Migration, status.Down, func(tx *tx) error {
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", status.Version)
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+func (c Client) runMigration(ctx context.Context, m Migration, script string, record func(tx *tx) error) error {
+	tx, err := c.conn.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("couldn't record migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
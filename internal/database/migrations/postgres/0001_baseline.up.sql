@@ -0,0 +1,61 @@
+CREATE TABLE users (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	video_version_limit INTEGER,
+	quota_bytes BIGINT,
+	quota_videos INTEGER,
+	storage_used_bytes BIGINT NOT NULL DEFAULT 0,
+	video_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id UUID NOT NULL REFERENCES users(id),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE videos (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id UUID NOT NULL REFERENCES users(id),
+	current_version INTEGER,
+	video_checksum_sha256 TEXT,
+	encryption_key_id TEXT
+);
+
+CREATE TABLE video_versions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	video_id UUID NOT NULL REFERENCES videos(id),
+	version INTEGER NOT NULL,
+	object_key TEXT NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	content_type TEXT NOT NULL,
+	aspect_ratio TEXT NOT NULL,
+	uploaded_by UUID NOT NULL REFERENCES users(id),
+	checksum_sha256 TEXT,
+	UNIQUE(video_id, version)
+);
+
+CREATE TABLE content_objects (
+	hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT UNIQUE NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	content_type TEXT NOT NULL,
+	ref_count INTEGER NOT NULL,
+	encryption_key_id TEXT,
+	wrapped_data_key TEXT
+);
@@ -0,0 +1,3 @@
+-- The Postgres baseline was written with the corrected column types, so
+-- only the index the SQLite rebuild adds is needed to keep versions aligned.
+CREATE INDEX videos_user_id_idx ON videos(user_id, created_at);
@@ -0,0 +1,4 @@
+DROP INDEX videos_user_updated_idx;
+ALTER TABLE video_versions DROP COLUMN duration_seconds;
+ALTER TABLE videos DROP COLUMN orientation;
+ALTER TABLE videos DROP COLUMN duration_seconds;
@@ -0,0 +1,13 @@
+-- Columns the video list sorts and filters on. Orientation is backfilled
+-- from the current version; durations are only known for new uploads.
+ALTER TABLE videos ADD COLUMN duration_seconds DOUBLE PRECISION;
+ALTER TABLE videos ADD COLUMN orientation TEXT;
+ALTER TABLE video_versions ADD COLUMN duration_seconds DOUBLE PRECISION;
+
+UPDATE videos SET orientation = (
+	SELECT aspect_ratio FROM video_versions
+	WHERE video_versions.video_id = videos.id
+		AND video_versions.version = videos.current_version
+);
+
+CREATE INDEX videos_user_updated_idx ON videos(user_id, updated_at);
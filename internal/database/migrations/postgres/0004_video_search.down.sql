@@ -0,0 +1,5 @@
+DROP INDEX videos_search_vector_idx;
+DROP TRIGGER videos_search_vector_update ON videos;
+DROP TRIGGER videos_search_vector_insert ON videos;
+DROP FUNCTION videos_search_vector();
+ALTER TABLE videos DROP COLUMN search_vector;
@@ -0,0 +1,27 @@
+-- Full-text index over video titles and descriptions, kept in sync with the
+-- videos table by a trigger. Title matches weigh more than description ones.
+ALTER TABLE videos ADD COLUMN search_vector tsvector;
+
+CREATE FUNCTION videos_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', COALESCE(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('english', COALESCE(NEW.description, '')), 'B');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER videos_search_vector_insert BEFORE INSERT ON videos
+FOR EACH ROW EXECUTE FUNCTION videos_search_vector();
+
+-- UpdateVideo writes every column, so only reindex when the text changed.
+CREATE TRIGGER videos_search_vector_update BEFORE UPDATE OF title, description ON videos
+FOR EACH ROW
+WHEN (OLD.title IS DISTINCT FROM NEW.title OR OLD.description IS DISTINCT FROM NEW.description)
+EXECUTE FUNCTION videos_search_vector();
+
+UPDATE videos SET search_vector =
+	setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+	setweight(to_tsvector('english', COALESCE(description, '')), 'B');
+
+CREATE INDEX videos_search_vector_idx ON videos USING GIN (search_vector);
@@ -0,0 +1,16 @@
+-- Tags belong to a user and are shared by that user's videos.
+CREATE TABLE tags (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	UNIQUE(user_id, name)
+);
+
+CREATE TABLE video_tags (
+	video_id UUID NOT NULL REFERENCES videos(id),
+	tag_id UUID NOT NULL REFERENCES tags(id),
+	PRIMARY KEY(video_id, tag_id)
+);
+
+CREATE INDEX video_tags_tag_id_idx ON video_tags(tag_id);
@@ -0,0 +1,4 @@
+-- Deleted videos move to the trash until they are purged.
+ALTER TABLE videos ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX videos_deleted_at_idx ON videos(deleted_at);
@@ -0,0 +1,10 @@
+-- Without owner_id only one row per hash fits. Rows for content another row
+-- already holds are dropped; their objects stay in the bucket.
+DELETE FROM content_objects o
+WHERE EXISTS (
+	SELECT 1 FROM content_objects other
+	WHERE other.hash = o.hash AND other.owner_id < o.owner_id
+);
+ALTER TABLE content_objects DROP CONSTRAINT content_objects_pkey;
+ALTER TABLE content_objects DROP COLUMN owner_id;
+ALTER TABLE content_objects ADD PRIMARY KEY (hash);
@@ -0,0 +1,5 @@
+-- Objects stored under keys that name their user or video are deduplicated
+-- per owner. owner_id is '' for objects any user's upload may share.
+ALTER TABLE content_objects ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE content_objects DROP CONSTRAINT content_objects_pkey;
+ALTER TABLE content_objects ADD PRIMARY KEY (hash, owner_id);
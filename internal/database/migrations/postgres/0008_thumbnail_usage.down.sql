@@ -0,0 +1,7 @@
+UPDATE users
+SET storage_used_bytes = (
+	SELECT COALESCE(SUM(vv.size_bytes), 0)
+	FROM video_versions vv
+	JOIN videos v ON v.id = vv.video_id
+	WHERE v.user_id = users.id
+);
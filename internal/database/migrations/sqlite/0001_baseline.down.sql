@@ -0,0 +1,5 @@
+DROP TABLE content_objects;
+DROP TABLE video_versions;
+DROP TABLE videos;
+DROP TABLE refresh_tokens;
+DROP TABLE users;
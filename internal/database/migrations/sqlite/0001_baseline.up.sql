@@ -0,0 +1,66 @@
+-- The schema as autoMigrate left it before migrations were versioned.
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	video_version_limit INTEGER,
+	quota_bytes INTEGER,
+	quota_videos INTEGER,
+	storage_used_bytes INTEGER NOT NULL DEFAULT 0,
+	video_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	current_version INTEGER,
+	video_checksum_sha256 TEXT,
+	encryption_key_id TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE video_versions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	object_key TEXT NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	aspect_ratio TEXT NOT NULL,
+	uploaded_by TEXT NOT NULL,
+	checksum_sha256 TEXT,
+	UNIQUE(video_id, version),
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(uploaded_by) REFERENCES users(id)
+);
+
+CREATE TABLE content_objects (
+	hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT UNIQUE NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	ref_count INTEGER NOT NULL,
+	encryption_key_id TEXT,
+	wrapped_data_key TEXT
+);
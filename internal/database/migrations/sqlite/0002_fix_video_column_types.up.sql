@@ -0,0 +1,30 @@
+-- video_url was declared "TEXT TEXT" and user_id INTEGER although it holds
+-- user UUIDs. SQLite can't change a column's type, so the table is rebuilt.
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT NOT NULL,
+	current_version INTEGER,
+	video_checksum_sha256 TEXT,
+	encryption_key_id TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, current_version, video_checksum_sha256, encryption_key_id
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	CAST(user_id AS TEXT), current_version, video_checksum_sha256, encryption_key_id
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX videos_user_id_idx ON videos(user_id, created_at);
@@ -0,0 +1,19 @@
+-- Columns the video list sorts and filters on. Orientation is backfilled
+-- from the current version; durations are only known for new uploads.
+ALTER TABLE videos ADD COLUMN duration_seconds REAL;
+ALTER TABLE videos ADD COLUMN orientation TEXT;
+ALTER TABLE video_versions ADD COLUMN duration_seconds REAL;
+
+UPDATE videos SET orientation = (
+	SELECT aspect_ratio FROM video_versions
+	WHERE video_versions.video_id = videos.id
+		AND video_versions.version = videos.current_version
+);
+
+-- Timestamps were written with CURRENT_TIMESTAMP and are now written by the
+-- driver, which appends the UTC offset. Rewrite the old ones the same way so
+-- they compare correctly as text against list cursors.
+UPDATE videos SET created_at = created_at || '+00:00' WHERE length(created_at) = 19;
+UPDATE videos SET updated_at = updated_at || '+00:00' WHERE length(updated_at) = 19;
+
+CREATE INDEX videos_user_updated_idx ON videos(user_id, updated_at);
@@ -0,0 +1,33 @@
+-- Full-text index over video titles and descriptions, kept in sync with the
+-- videos table by triggers. The porter tokenizer matches the English stemming
+-- Postgres uses; prefix indexes speed up short prefix queries.
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tokenize = 'porter unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, COALESCE(description, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos
+BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+-- UpdateVideo writes every column, so only reindex when the text changed.
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos
+WHEN old.title IS NOT new.title OR old.description IS NOT new.description
+BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = COALESCE(new.description, '')
+	WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos
+BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
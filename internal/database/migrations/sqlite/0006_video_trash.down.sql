@@ -0,0 +1,2 @@
+DROP INDEX videos_deleted_at_idx;
+ALTER TABLE videos DROP COLUMN deleted_at;
@@ -0,0 +1,22 @@
+-- Without owner_id only one row per hash fits. Rows for content another row
+-- already holds are dropped; their objects stay in the bucket.
+CREATE TABLE content_objects_old (
+	hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT UNIQUE NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	ref_count INTEGER NOT NULL,
+	encryption_key_id TEXT,
+	wrapped_data_key TEXT
+);
+
+INSERT OR IGNORE INTO content_objects_old SELECT
+	hash, created_at, updated_at, object_key, size_bytes, content_type,
+	ref_count, encryption_key_id, wrapped_data_key
+FROM content_objects
+ORDER BY owner_id;
+
+DROP TABLE content_objects;
+ALTER TABLE content_objects_old RENAME TO content_objects;
@@ -0,0 +1,28 @@
+-- Objects stored under keys that name their user or video are deduplicated
+-- per owner. owner_id is '' for objects any user's upload may share.
+-- SQLite can't change a primary key, so the table is rebuilt.
+CREATE TABLE content_objects_new (
+	hash TEXT NOT NULL,
+	owner_id TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT UNIQUE NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	ref_count INTEGER NOT NULL,
+	encryption_key_id TEXT,
+	wrapped_data_key TEXT,
+	PRIMARY KEY (hash, owner_id)
+);
+
+INSERT INTO content_objects_new (
+	hash, created_at, updated_at, object_key, size_bytes, content_type,
+	ref_count, encryption_key_id, wrapped_data_key
+)
+SELECT
+	hash, created_at, updated_at, object_key, size_bytes, content_type,
+	ref_count, encryption_key_id, wrapped_data_key
+FROM content_objects;
+
+DROP TABLE content_objects;
+ALTER TABLE content_objects_new RENAME TO content_objects;
@@ -0,0 +1,14 @@
+-- Thumbnails stored in the bucket now count towards their owner's storage,
+-- as RecalculateUsage counts them.
+UPDATE users
+SET storage_used_bytes = (
+	SELECT COALESCE(SUM(vv.size_bytes), 0)
+	FROM video_versions vv
+	JOIN videos v ON v.id = vv.video_id
+	WHERE v.user_id = users.id
+) + (
+	SELECT COALESCE(SUM(co.size_bytes), 0)
+	FROM videos v
+	JOIN content_objects co ON co.object_key = v.thumbnail_url
+	WHERE v.user_id = users.id
+);
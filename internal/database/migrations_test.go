@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestSearchIndexMigration runs with and without -tags sqlite_fts5: builds
+// without FTS5 must leave 0004 pending rather than record it, and builds
+// with it must create the index a build without it skipped.
+func TestSearchIndexMigration(t *testing.T) {
+	ctx := context.Background()
+	c := openClient(t, filepath.Join(t.TempDir(), "tubely.db"))
+	user := createTestUser(t, c, "walt@example.com")
+	video := createTestVideo(t, c, user.ID, "Chemistry lesson", nil)
+
+	searchIndex := func() MigrationStatus {
+		t.Helper()
+		statuses, err := c.MigrationStatus(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range statuses {
+			if c.createsSearchIndex(status.Migration) {
+				return status
+			}
+		}
+		t.Fatal("no migration creates the search index")
+		return MigrationStatus{}
+	}
+
+	if !sqliteFTS5 {
+		if status := searchIndex(); status.AppliedAt != nil || !status.Unsupported {
+			t.Fatalf("search index migration = %+v, want it pending and unsupported", status)
+		}
+		if err := c.CheckMigrations(ctx); err != nil {
+			t.Errorf("CheckMigrations = %v, want the search index ignored", err)
+		}
+		return
+	}
+
+	// Simulate a database an older build without FTS5 migrated: 0004 is
+	// recorded but the index doesn't exist.
+	status := searchIndex()
+	if status.AppliedAt == nil {
+		t.Fatalf("search index migration = %+v, want it applied", status)
+	}
+	if _, err := c.db.ExecContext(ctx, status.Down); err != nil {
+		t.Fatal(err)
+	}
+	if status := searchIndex(); status.AppliedAt != nil || status.Unsupported {
+		t.Fatalf("search index migration without its index = %+v, want it pending", status)
+	}
+	if err := c.CheckMigrations(ctx); !errors.Is(err, ErrMigrationsPending) {
+		t.Errorf("CheckMigrations = %v, want ErrMigrationsPending", err)
+	}
+
+	applied, err := c.MigrateUp(ctx)
+	if err != nil || len(applied) != 1 || applied[0].Version != status.Version {
+		t.Fatalf("MigrateUp = %+v, %v, want only %04d_%s", applied, err, status.Version, status.Name)
+	}
+	results, err := c.SearchVideos(ctx, SearchVideosParams{UserID: user.ID, Query: "chemistry", Limit: 10})
+	if err != nil || len(results) != 1 || results[0].Video.ID != video.ID {
+		t.Errorf("SearchVideos = %+v, %v, want the video from before the index", results, err)
+	}
+	if err := c.CheckMigrations(ctx); err != nil {
+		t.Errorf("CheckMigrations after MigrateUp = %v", err)
+	}
+}
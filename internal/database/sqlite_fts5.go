@@ -0,0 +1,7 @@
+//go:build sqlite_fts5 || fts5
+
+package database
+
+// sqliteFTS5 reports whether go-sqlite3 was built with FTS5, which the video
+// search index needs. Without it, SQLite search falls back to LIKE.
+const sqliteFTS5 = true
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The store interfaces are the parts of the database the HTTP handlers and
+// maintenance commands depend on; only schema migrations need a Client.
+// Client implements them with SQL and MemoryStore in process memory. Like
+// Client, lookups that find nothing return a zero value (or nil) and a nil
+// error.
+type UserStore interface {
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserVideoVersionLimit(ctx context.Context, id uuid.UUID) (*int, error)
+	SetUserVideoVersionLimit(ctx context.Context, id uuid.UUID, limit *int) error
+}
+
+type UsageStore interface {
+	GetUserUsage(ctx context.Context, userID uuid.UUID) (UserUsage, error)
+	ReserveUserStorage(ctx context.Context, userID uuid.UUID, bytes, quotaBytes int64) (bool, error)
+	ReserveUserVideo(ctx context.Context, userID uuid.UUID, quotaVideos int) (bool, error)
+	AddUserStorageUsage(ctx context.Context, userID uuid.UUID, delta int64) error
+	AddUserVideoCount(ctx context.Context, userID uuid.UUID, delta int) error
+}
+
+type VideoStore interface {
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	ListVideos(ctx context.Context, params ListVideosParams) ([]Video, *VideoCursor, error)
+	SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error)
+	UpdateVideo(ctx context.Context, video Video) error
+	UpdateVideoIfUnchanged(ctx context.Context, video Video) error
+	SetVideoURLIfUnchanged(ctx context.Context, id uuid.UUID, oldURL, newURL string) (bool, error)
+	SetThumbnailURLIfUnchanged(ctx context.Context, id uuid.UUID, oldURL, newURL string) (bool, error)
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+	TrashVideo(ctx context.Context, id uuid.UUID) error
+	RestoreVideo(ctx context.Context, id, userID uuid.UUID) (bool, error)
+	ListTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	ListVideosTrashedBefore(ctx context.Context, cutoff time.Time, after *Video, limit int) ([]Video, error)
+	DeleteTrashedVideo(ctx context.Context, id uuid.UUID) error
+	GetAllVideos(ctx context.Context) ([]Video, error)
+}
+
+type VideoVersionStore interface {
+	CreateVideoVersion(ctx context.Context, params CreateVideoVersionParams) (VideoVersion, error)
+	GetVideoVersions(ctx context.Context, videoID uuid.UUID) ([]VideoVersion, error)
+	GetVideoVersion(ctx context.Context, videoID uuid.UUID, version int) (VideoVersion, error)
+	DeleteVideoVersion(ctx context.Context, id uuid.UUID) error
+	GetAllVideoVersions(ctx context.Context) ([]VideoVersion, error)
+}
+
+type ContentObjectStore interface {
+	GetContentObject(ctx context.Context, hash string, owner *uuid.UUID) (ContentObject, error)
+	GetContentObjectByKey(ctx context.Context, objectKey string) (ContentObject, error)
+	AcquireContentObject(ctx context.Context, hash string, owner *uuid.UUID) (bool, error)
+	CreateContentObject(ctx context.Context, params CreateContentObjectParams) (ContentObject, error)
+	ReleaseContentObject(ctx context.Context, objectKey string) (int, error)
+	RenameObjectKey(ctx context.Context, oldKey, newKey string) error
+	GetEncryptedContentObjects(ctx context.Context, exceptKeyID string) ([]ContentObject, error)
+	RewrapContentObject(ctx context.Context, obj ContentObject, oldKeyID, keyID, wrappedDataKey string) (bool, error)
+}
+
+type TagStore interface {
+	SetVideoTags(ctx context.Context, videoID uuid.UUID, names []string) error
+	ListTags(ctx context.Context, userID uuid.UUID) ([]TagCount, error)
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	GetUserByRefreshToken(ctx context.Context, token string) (*User, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+}
+
+// Store is every store at once. WithTx hands fn a Store whose calls all
+// run in one transaction, and Reset empties it.
+type Store interface {
+	UserStore
+	UsageStore
+	VideoStore
+	VideoVersionStore
+	ContentObjectStore
+	TagStore
+	RefreshTokenStore
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+	Reset(ctx context.Context) error
+}
+
+var (
+	_ Store = Client{}
+	_ Store = (*MemoryStore)(nil)
+)
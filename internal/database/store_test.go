@@ -0,0 +1,652 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The store tests run against every Store: MemoryStore, Client on a fresh
+// SQLite file and, when TEST_POSTGRES_URL names a database the tests may
+// empty, Client on Postgres. CI must set it: with CI set, a missing
+// TEST_POSTGRES_URL fails the Postgres tests instead of skipping them.
+var storeTests = []struct {
+	name string
+	run  func(t *testing.T, s Store)
+}{
+	{"Users", testUsers},
+	{"Quotas", testQuotas},
+	{"Videos", testVideos},
+	{"Trash", testTrash},
+	{"VideoVersions", testVideoVersions},
+	{"ContentObjects", testContentObjects},
+	{"Maintenance", testMaintenance},
+	{"Tags", testTags},
+	{"Search", testSearch},
+	{"RefreshTokens", testRefreshTokens},
+	{"WithTx", testWithTx},
+}
+
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+		{"sqlite", openSQLiteStore},
+		{"postgres", openPostgresStore},
+	}
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			for _, test := range storeTests {
+				t.Run(test.name, func(t *testing.T) {
+					test.run(t, store.open(t))
+				})
+			}
+		})
+	}
+}
+
+func openSQLiteStore(t *testing.T) Store {
+	t.Helper()
+	return openClient(t, filepath.Join(t.TempDir(), "tubely.db"))
+}
+
+func openPostgresStore(t *testing.T) Store {
+	t.Helper()
+	dbURL := os.Getenv("TEST_POSTGRES_URL")
+	if dbURL == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_POSTGRES_URL must be set in CI")
+		}
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	c := openClient(t, dbURL)
+	if err := c.Reset(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func openClient(t *testing.T, dbURL string) Client {
+	t.Helper()
+	c, err := NewClient(dbURL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func createTestUser(t *testing.T, s Store, email string) User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *user
+}
+
+func createTestVideo(t *testing.T, s Store, userID uuid.UUID, title string, description *string) Video {
+	t.Helper()
+	video, err := s.CreateVideo(context.Background(), CreateVideoParams{UserID: userID, Title: title, Description: description})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+func testUsers(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createTestUser(t, s, "walt@example.com")
+
+	got, err := s.GetUser(ctx, user.ID)
+	if err != nil || got == nil || got.Email != "walt@example.com" {
+		t.Fatalf("GetUser = %v, %v, want walt", got, err)
+	}
+	byEmail, err := s.GetUserByEmail(ctx, "walt@example.com")
+	if err != nil || byEmail.ID != user.ID {
+		t.Fatalf("GetUserByEmail = %v, %v, want %s", byEmail, err, user.ID)
+	}
+	if got, err := s.GetUser(ctx, uuid.New()); err != nil || got != nil {
+		t.Errorf("GetUser of an unknown ID = %v, %v, want nil", got, err)
+	}
+
+	limit := 3
+	if err := s.SetUserVideoVersionLimit(ctx, user.ID, &limit); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetUserVideoVersionLimit(ctx, user.ID); err != nil || got == nil || *got != 3 {
+		t.Errorf("GetUserVideoVersionLimit = %v, %v, want 3", got, err)
+	}
+	if err := s.SetUserVideoVersionLimit(ctx, user.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetUserVideoVersionLimit(ctx, user.ID); err != nil || got != nil {
+		t.Errorf("GetUserVideoVersionLimit after clearing = %v, %v, want nil", got, err)
+	}
+}
+
+// testQuotas uses sizes past the range of a 32-bit integer, which Postgres
+// rejected when an unlimited quota reached the reservation query.
+func testQuotas(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createTestUser(t, s, "walt@example.com")
+
+	reserve := func(bytes, quota int64, want bool) {
+		t.Helper()
+		ok, err := s.ReserveUserStorage(ctx, user.ID, bytes, quota)
+		if err != nil || ok != want {
+			t.Fatalf("ReserveUserStorage(%d, %d) = %v, %v, want %v", bytes, quota, ok, err, want)
+		}
+	}
+	reserve(3<<30, 0, true)
+	reserve(1<<30, 5<<30, true)
+	reserve(2<<30, 5<<30, false)
+
+	for i, quota := range []int{1, 1, 0} {
+		ok, err := s.ReserveUserVideo(ctx, user.ID, quota)
+		if err != nil || ok != (i != 1) {
+			t.Fatalf("ReserveUserVideo #%d with quota %d = %v, %v", i+1, quota, ok, err)
+		}
+	}
+
+	usage, err := s.GetUserUsage(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.UserID != user.ID || usage.StorageUsedBytes != 4<<30 || usage.VideoCount != 2 {
+		t.Errorf("usage = %+v, want 4 GiB and 2 videos", usage)
+	}
+
+	if err := s.AddUserStorageUsage(ctx, user.ID, -(8 << 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUserVideoCount(ctx, user.ID, -5); err != nil {
+		t.Fatal(err)
+	}
+	usage, err = s.GetUserUsage(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.StorageUsedBytes != 0 || usage.VideoCount != 0 {
+		t.Errorf("usage = %+v, want it to stop at zero", usage)
+	}
+
+	if ok, err := s.ReserveUserVideo(ctx, uuid.New(), 0); err != nil || ok {
+		t.Errorf("ReserveUserVideo for an unknown user = %v, %v, want false", ok, err)
+	}
+}
+
+func testVideos(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := createTestUser(t, s, "walt@example.com")
+	jesse := createTestUser(t, s, "jesse@example.com")
+
+	description := "The one with the RV"
+	video := createTestVideo(t, s, walt.ID, "Pilot", &description)
+	createTestVideo(t, s, jesse.ID, "Cat's in the Bag", nil)
+
+	got, err := s.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Pilot" || got.Description == nil || *got.Description != description || !got.UpdatedAt.Equal(video.UpdatedAt) {
+		t.Errorf("GetVideo = %+v, want %+v", got, video)
+	}
+	if got, err := s.GetVideo(ctx, uuid.New()); err != nil || got.ID != uuid.Nil {
+		t.Errorf("GetVideo of an unknown ID = %+v, %v, want the zero video", got, err)
+	}
+
+	videos, _, err := s.ListVideos(ctx, ListVideosParams{UserID: walt.ID, Sort: VideoSortCreated, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 1 || videos[0].ID != video.ID {
+		t.Errorf("ListVideos = %+v, want only Pilot", videos)
+	}
+
+	got.Title = "Pilot (remastered)"
+	got.Description = nil
+	if err := s.UpdateVideoIfUnchanged(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "Pilot (remastered)" || updated.Description != nil {
+		t.Errorf("updated video = %+v, want the new title and no description", updated)
+	}
+
+	stale := updated
+	stale.UpdatedAt = updated.UpdatedAt.Add(-time.Second)
+	stale.Title = "Stale"
+	if err := s.UpdateVideoIfUnchanged(ctx, stale); !errors.Is(err, ErrVideoModified) {
+		t.Errorf("UpdateVideoIfUnchanged of a stale copy = %v, want ErrVideoModified", err)
+	}
+}
+
+func testTrash(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := createTestUser(t, s, "walt@example.com")
+	jesse := createTestUser(t, s, "jesse@example.com")
+
+	var trashed []uuid.UUID
+	for range 5 {
+		video := createTestVideo(t, s, walt.ID, "Episode", nil)
+		if err := s.TrashVideo(ctx, video.ID); err != nil {
+			t.Fatal(err)
+		}
+		trashed = append(trashed, video.ID)
+	}
+	kept := createTestVideo(t, s, walt.ID, "Keeper", nil)
+
+	if got, err := s.GetVideo(ctx, trashed[0]); err != nil || got.ID != uuid.Nil {
+		t.Errorf("GetVideo of a trashed video = %+v, %v, want the zero video", got, err)
+	}
+	if err := s.DeleteTrashedVideo(ctx, kept.ID); !errors.Is(err, ErrVideoNotTrashed) {
+		t.Errorf("DeleteTrashedVideo of a live video = %v, want ErrVideoNotTrashed", err)
+	}
+
+	videos, err := s.ListTrashedVideos(ctx, walt.ID)
+	if err != nil || len(videos) != 5 {
+		t.Fatalf("ListTrashedVideos = %d videos, %v, want 5", len(videos), err)
+	}
+
+	// Page through the trash two at a time; every video turns up once.
+	var seen []uuid.UUID
+	var after *Video
+	for {
+		page, err := s.ListVideosTrashedBefore(ctx, time.Now().Add(time.Hour), after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, video := range page {
+			seen = append(seen, video.ID)
+		}
+		if len(page) < 2 {
+			break
+		}
+		after = &page[len(page)-1]
+	}
+	slices.SortFunc(seen, compareUUIDs)
+	slices.SortFunc(trashed, compareUUIDs)
+	if !slices.Equal(seen, trashed) {
+		t.Errorf("paged trash = %v, want %v", seen, trashed)
+	}
+	if page, err := s.ListVideosTrashedBefore(ctx, time.Now().Add(-time.Hour), nil, 10); err != nil || len(page) != 0 {
+		t.Errorf("ListVideosTrashedBefore an hour ago = %d videos, %v, want none", len(page), err)
+	}
+
+	if ok, err := s.RestoreVideo(ctx, trashed[0], jesse.ID); err != nil || ok {
+		t.Errorf("RestoreVideo by another user = %v, %v, want false", ok, err)
+	}
+	if ok, err := s.RestoreVideo(ctx, trashed[0], walt.ID); err != nil || !ok {
+		t.Errorf("RestoreVideo by the owner = %v, %v, want true", ok, err)
+	}
+	if err := s.DeleteTrashedVideo(ctx, trashed[1]); err != nil {
+		t.Fatal(err)
+	}
+	videos, err = s.ListTrashedVideos(ctx, walt.ID)
+	if err != nil || len(videos) != 3 {
+		t.Errorf("ListTrashedVideos = %d videos, %v, want 3", len(videos), err)
+	}
+}
+
+func compareUUIDs(a, b uuid.UUID) int {
+	return slices.Compare(a[:], b[:])
+}
+
+func testVideoVersions(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createTestUser(t, s, "walt@example.com")
+	video := createTestVideo(t, s, user.ID, "Pilot", nil)
+
+	create := func(key string) VideoVersion {
+		t.Helper()
+		version, err := s.CreateVideoVersion(ctx, CreateVideoVersionParams{
+			VideoID:     video.ID,
+			ObjectKey:   key,
+			SizeBytes:   1,
+			ContentType: "video/mp4",
+			AspectRatio: "landscape",
+			UploadedBy:  user.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+	for i, key := range []string{"first.mp4", "second.mp4", "third.mp4"} {
+		if version := create(key); version.Version != i+1 {
+			t.Errorf("version of %s = %d, want %d", key, version.Version, i+1)
+		}
+	}
+
+	versions, err := s.GetVideoVersions(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int
+	for _, version := range versions {
+		numbers = append(numbers, version.Version)
+	}
+	if !slices.Equal(numbers, []int{3, 2, 1}) {
+		t.Errorf("GetVideoVersions = %v, want newest first", numbers)
+	}
+
+	second, err := s.GetVideoVersion(ctx, video.ID, 2)
+	if err != nil || second.ObjectKey != "second.mp4" {
+		t.Fatalf("GetVideoVersion(2) = %+v, %v, want second.mp4", second, err)
+	}
+	if err := s.DeleteVideoVersion(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetVideoVersion(ctx, video.ID, 2); err != nil || got.ID != uuid.Nil {
+		t.Errorf("GetVideoVersion of a deleted version = %+v, %v, want the zero version", got, err)
+	}
+	if version := create("fourth.mp4"); version.Version != 4 {
+		t.Errorf("version after a deletion = %d, want 4", version.Version)
+	}
+}
+
+func testContentObjects(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	params := CreateContentObjectParams{Hash: "abc123", ObjectKey: "first.mp4", SizeBytes: 3, ContentType: "video/mp4"}
+	obj, err := s.CreateContentObject(ctx, params)
+	if err != nil || obj.RefCount != 1 {
+		t.Fatalf("CreateContentObject = %+v, %v, want one reference", obj, err)
+	}
+	// Uploading the same content again keeps the first object.
+	params.ObjectKey = "duplicate.mp4"
+	obj, err = s.CreateContentObject(ctx, params)
+	if err != nil || obj.RefCount != 2 || obj.ObjectKey != "first.mp4" {
+		t.Fatalf("CreateContentObject of a duplicate = %+v, %v, want first.mp4 with two references", obj, err)
+	}
+
+	// An owned copy of the same content is a separate object.
+	owner := uuid.New()
+	owned := params
+	owned.ObjectKey = "owned.mp4"
+	owned.OwnerID = &owner
+	obj, err = s.CreateContentObject(ctx, owned)
+	if err != nil || obj.RefCount != 1 || obj.ObjectKey != "owned.mp4" || obj.OwnerID == nil || *obj.OwnerID != owner {
+		t.Fatalf("CreateContentObject for an owner = %+v, %v, want owned.mp4 with one reference", obj, err)
+	}
+	stranger := uuid.New()
+	if ok, err := s.AcquireContentObject(ctx, "abc123", &stranger); err != nil || ok {
+		t.Errorf("AcquireContentObject for another owner = %v, %v, want false", ok, err)
+	}
+	if got, err := s.GetContentObject(ctx, "abc123", &owner); err != nil || got.ObjectKey != "owned.mp4" {
+		t.Errorf("GetContentObject for the owner = %+v, %v, want owned.mp4", got, err)
+	}
+
+	if ok, err := s.AcquireContentObject(ctx, "abc123", nil); err != nil || !ok {
+		t.Errorf("AcquireContentObject = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.AcquireContentObject(ctx, "missing", nil); err != nil || ok {
+		t.Errorf("AcquireContentObject of an unknown hash = %v, %v, want false", ok, err)
+	}
+	if got, err := s.GetContentObjectByKey(ctx, "first.mp4"); err != nil || got.Hash != "abc123" || got.RefCount != 3 {
+		t.Errorf("GetContentObjectByKey = %+v, %v, want abc123 with three references", got, err)
+	}
+
+	for want := 2; want >= 0; want-- {
+		if remaining, err := s.ReleaseContentObject(ctx, "first.mp4"); err != nil || remaining != want {
+			t.Fatalf("ReleaseContentObject = %d, %v, want %d", remaining, err, want)
+		}
+	}
+	if got, err := s.GetContentObject(ctx, "abc123", nil); err != nil || got.ObjectKey != "" {
+		t.Errorf("GetContentObject after the last release = %+v, %v, want none", got, err)
+	}
+	if got, err := s.GetContentObject(ctx, "abc123", &owner); err != nil || got.RefCount != 1 {
+		t.Errorf("owned object after releasing the shared one = %+v, %v, want it kept", got, err)
+	}
+	if remaining, err := s.ReleaseContentObject(ctx, "missing.mp4"); err != nil || remaining != 0 {
+		t.Errorf("ReleaseContentObject of an unknown key = %d, %v, want 0", remaining, err)
+	}
+}
+
+// testMaintenance covers what migrate-keys and rotate-keys need beyond the
+// handlers.
+func testMaintenance(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createTestUser(t, s, "walt@example.com")
+	video := createTestVideo(t, s, user.ID, "Pilot", nil)
+	trashed := createTestVideo(t, s, user.ID, "Cat's in the Bag", nil)
+	if err := s.TrashVideo(ctx, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.CreateVideoVersion(ctx, CreateVideoVersionParams{
+		VideoID:     video.ID,
+		ObjectKey:   "old.mp4",
+		SizeBytes:   1,
+		ContentType: "video/mp4",
+		AspectRatio: "landscape",
+		UploadedBy:  user.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeyID, wrapped := "old", "wrapped-by-old"
+	_, err = s.CreateContentObject(ctx, CreateContentObjectParams{
+		Hash:            "abc123",
+		ObjectKey:       "old.mp4",
+		SizeBytes:       1,
+		ContentType:     "video/mp4",
+		EncryptionKeyID: &oldKeyID,
+		WrappedDataKey:  &wrapped,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	videos, err := s.GetAllVideos(ctx)
+	if err != nil || len(videos) != 2 {
+		t.Fatalf("GetAllVideos = %d videos, %v, want both, trashed or not", len(videos), err)
+	}
+
+	if err := s.RenameObjectKey(ctx, "old.mp4", "new.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetContentObjectByKey(ctx, "new.mp4"); err != nil || got.Hash != "abc123" {
+		t.Errorf("GetContentObjectByKey after a rename = %+v, %v, want abc123", got, err)
+	}
+	versions, err := s.GetAllVideoVersions(ctx)
+	if err != nil || len(versions) != 1 || versions[0].ObjectKey != "new.mp4" {
+		t.Errorf("GetAllVideoVersions after a rename = %+v, %v, want new.mp4", versions, err)
+	}
+
+	// The URL setters only apply over the URL the caller read.
+	if set, err := s.SetVideoURLIfUnchanged(ctx, video.ID, "old.mp4", "new.mp4"); err != nil || set {
+		t.Errorf("SetVideoURLIfUnchanged of an unset URL = %v, %v, want false", set, err)
+	}
+	thumbnail := "old.png"
+	video.ThumbnailURL = &thumbnail
+	if err := s.UpdateVideo(ctx, video); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := s.SetThumbnailURLIfUnchanged(ctx, video.ID, "old.png", "new.png"); err != nil || !set {
+		t.Errorf("SetThumbnailURLIfUnchanged = %v, %v, want true", set, err)
+	}
+	if set, err := s.SetThumbnailURLIfUnchanged(ctx, video.ID, "old.png", "newer.png"); err != nil || set {
+		t.Errorf("SetThumbnailURLIfUnchanged of a stale URL = %v, %v, want false", set, err)
+	}
+	video, err = s.GetVideo(ctx, video.ID)
+	if err != nil || video.ThumbnailURL == nil || *video.ThumbnailURL != "new.png" || video.Title != "Pilot" {
+		t.Fatalf("video after SetThumbnailURLIfUnchanged = %+v, %v, want new.png and the rest kept", video, err)
+	}
+
+	key := "new.mp4"
+	video.VideoURL = &key
+	video.EncryptionKeyID = &oldKeyID
+	if err := s.UpdateVideo(ctx, video); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := s.GetEncryptedContentObjects(ctx, "active")
+	if err != nil || len(objs) != 1 {
+		t.Fatalf("GetEncryptedContentObjects = %+v, %v, want abc123", objs, err)
+	}
+	if ok, err := s.RewrapContentObject(ctx, objs[0], "old", "active", "wrapped-by-active"); err != nil || !ok {
+		t.Fatalf("RewrapContentObject = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.RewrapContentObject(ctx, objs[0], "old", "active", "wrapped-again"); err != nil || ok {
+		t.Errorf("RewrapContentObject of a rewrapped object = %v, %v, want false", ok, err)
+	}
+	if objs, err := s.GetEncryptedContentObjects(ctx, "active"); err != nil || len(objs) != 0 {
+		t.Errorf("GetEncryptedContentObjects after rewrapping = %+v, %v, want none", objs, err)
+	}
+	got, err := s.GetContentObject(ctx, "abc123", nil)
+	if err != nil || got.WrappedDataKey == nil || *got.WrappedDataKey != "wrapped-by-active" {
+		t.Errorf("GetContentObject after rewrapping = %+v, %v, want the new wrapped key", got, err)
+	}
+	if got, err := s.GetVideo(ctx, video.ID); err != nil || got.EncryptionKeyID == nil || *got.EncryptionKeyID != "active" {
+		t.Errorf("video after rewrapping = %+v, %v, want the active key", got, err)
+	}
+}
+
+func testTags(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := createTestUser(t, s, "walt@example.com")
+	jesse := createTestUser(t, s, "jesse@example.com")
+	pilot := createTestVideo(t, s, walt.ID, "Pilot", nil)
+	bag := createTestVideo(t, s, walt.ID, "Cat's in the Bag", nil)
+	other := createTestVideo(t, s, jesse.ID, "Crazy Handful of Nothin'", nil)
+
+	for id, tags := range map[uuid.UUID][]string{
+		pilot.ID: {"drama", "chemistry"},
+		bag.ID:   {"drama"},
+		other.ID: {"comedy"},
+	} {
+		if err := s.SetVideoTags(ctx, id, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.GetVideo(ctx, pilot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Tags, []string{"chemistry", "drama"}) {
+		t.Errorf("tags = %q, want them sorted", got.Tags)
+	}
+
+	counts, err := s.ListTags(ctx, walt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TagCount{{Name: "drama", VideoCount: 2}, {Name: "chemistry", VideoCount: 1}}
+	if !slices.Equal(counts, want) {
+		t.Errorf("ListTags = %+v, want %+v", counts, want)
+	}
+}
+
+func testSearch(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := createTestUser(t, s, "walt@example.com")
+	jesse := createTestUser(t, s, "jesse@example.com")
+
+	description := "An unexpected chemistry teacher"
+	inDescription := createTestVideo(t, s, walt.ID, "Pilot", &description)
+	inTitle := createTestVideo(t, s, walt.ID, "Chemistry lesson", nil)
+	createTestVideo(t, s, walt.ID, "Gray Matter", nil)
+	createTestVideo(t, s, jesse.ID, "Chemistry lab", nil)
+
+	results, err := s.SearchVideos(ctx, SearchVideosParams{UserID: walt.ID, Query: "chemistry", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Video.ID != inTitle.ID || results[1].Video.ID != inDescription.ID {
+		t.Fatalf("SearchVideos = %+v, want the title match, then the description match", results)
+	}
+	if got := results[0].TitleHighlight; got != "<mark>Chemistry</mark> lesson" {
+		t.Errorf("title_highlight = %q", got)
+	}
+	if got := results[1].DescriptionSnippet; got != "An unexpected <mark>chemistry</mark> teacher" {
+		t.Errorf("description_snippet = %q", got)
+	}
+
+	results, err = s.SearchVideos(ctx, SearchVideosParams{UserID: walt.ID, Query: "chemistry", Limit: 10, Offset: 1})
+	if err != nil || len(results) != 1 || results[0].Video.ID != inDescription.ID {
+		t.Errorf("SearchVideos from offset 1 = %+v, %v, want the description match", results, err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createTestUser(t, s, "walt@example.com")
+
+	_, err := s.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "token",
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetUserByRefreshToken(ctx, "token"); err != nil || got == nil || got.ID != user.ID {
+		t.Errorf("GetUserByRefreshToken = %v, %v, want %s", got, err, user.ID)
+	}
+	if got, err := s.GetUserByRefreshToken(ctx, "unknown"); err != nil || got != nil {
+		t.Errorf("GetUserByRefreshToken of an unknown token = %v, %v, want nil", got, err)
+	}
+	if err := s.RevokeRefreshToken(ctx, "token"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWithTx(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createTestUser(t, s, "walt@example.com")
+
+	errRollback := errors.New("rollback")
+	var created Video
+	err := s.WithTx(ctx, func(tx Store) error {
+		if _, err := tx.ReserveUserVideo(ctx, user.ID, 0); err != nil {
+			return err
+		}
+		var err error
+		created, err = tx.CreateVideo(ctx, CreateVideoParams{UserID: user.ID, Title: "Pilot"})
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v, want the callback's error", err)
+	}
+	if got, err := s.GetVideo(ctx, created.ID); err != nil || got.ID != uuid.Nil {
+		t.Errorf("GetVideo after a rollback = %+v, %v, want the zero video", got, err)
+	}
+	if usage, err := s.GetUserUsage(ctx, user.ID); err != nil || usage.VideoCount != 0 {
+		t.Errorf("usage after a rollback = %+v, %v, want no videos", usage, err)
+	}
+
+	err = s.WithTx(ctx, func(tx Store) error {
+		created, err = tx.CreateVideo(ctx, CreateVideoParams{UserID: user.ID, Title: "Pilot"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetVideo(ctx, created.ID); err != nil || got.ID != created.ID {
+		t.Errorf("GetVideo after a commit = %+v, %v, want %s", got, err, created.ID)
+	}
+
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetUser(ctx, user.ID); err != nil || got != nil {
+		t.Errorf("GetUser after Reset = %v, %v, want nil", got, err)
+	}
+}
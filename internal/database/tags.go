@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TagCount is one of a user's tags and how many of their videos carry it.
+type TagCount struct {
+	Name       string `json:"name"`
+	VideoCount int    `json:"video_count"`
+}
+
+// placeholders returns n comma-separated "?" placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// SetVideoTags replaces the video's tags with names, which must already be
+// normalized and distinct, and bumps its updated_at. Tags no video uses any
+// more are removed.
+func (c Client) SetVideoTags(ctx context.Context, videoID uuid.UUID, names []string) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.withTx(ctx, func(tx Client) error {
+		if err := tx.setVideoTags(ctx, videoID, names); err != nil {
+			return err
+		}
+		_, err := tx.db.ExecContext(ctx, `UPDATE videos SET updated_at = ? WHERE id = ?`, timestamp(), videoID)
+		return err
+	})
+}
+
+// setVideoTags is SetVideoTags without the updated_at bump, and must run in
+// a transaction.
+func (c Client) setVideoTags(ctx context.Context, videoID uuid.UUID, names []string) error {
+	var userID uuid.UUID
+	err := c.db.QueryRowContext(ctx, `SELECT user_id FROM videos WHERE id = ?`, videoID).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.ExecContext(ctx, `DELETE FROM video_tags WHERE video_id = ?`, videoID)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, err := c.db.ExecContext(ctx, `
+		INSERT INTO tags (id, created_at, user_id, name)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, name) DO NOTHING
+		`, uuid.New(), timestamp(), userID, name)
+		if err != nil {
+			return err
+		}
+		_, err = c.db.ExecContext(ctx, `
+		INSERT INTO video_tags (video_id, tag_id)
+		SELECT ?, id FROM tags WHERE user_id = ? AND name = ?
+		`, videoID, userID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return c.deleteUnusedTags(ctx, userID)
+}
+
+func (c Client) deleteUnusedTags(ctx context.Context, userID uuid.UUID) error {
+	_, err := c.db.ExecContext(ctx, `
+	DELETE FROM tags
+	WHERE user_id = ? AND id NOT IN (SELECT tag_id FROM video_tags)
+	`, userID)
+	return err
+}
+
+// ListTags returns the user's tags, most used first. Videos in the trash
+// aren't counted.
+func (c Client) ListTags(ctx context.Context, userID uuid.UUID) ([]TagCount, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT tags.name, COUNT(*) AS video_count
+	FROM tags
+	JOIN video_tags ON video_tags.tag_id = tags.id
+	JOIN videos ON videos.id = video_tags.video_id
+	WHERE tags.user_id = ? AND videos.deleted_at IS NULL
+	GROUP BY tags.name
+	ORDER BY video_count DESC, tags.name
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var count TagCount
+		if err := rows.Scan(&count.Name, &count.VideoCount); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// loadTags fills in the Tags of each video, sorted by name.
+func (c Client) loadTags(ctx context.Context, videos []Video) error {
+	if len(videos) == 0 {
+		return nil
+	}
+	byID := make(map[uuid.UUID]*Video, len(videos))
+	args := make([]any, len(videos))
+	for i := range videos {
+		videos[i].Tags = []string{}
+		byID[videos[i].ID] = &videos[i]
+		args[i] = videos[i].ID
+	}
+
+	query := `
+	SELECT video_tags.video_id, tags.name
+	FROM video_tags
+	JOIN tags ON tags.id = video_tags.tag_id
+	WHERE video_tags.video_id IN (` + placeholders(len(videos)) + `)
+	ORDER BY tags.name
+	`
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoID uuid.UUID
+		var name string
+		if err := rows.Scan(&videoID, &name); err != nil {
+			return err
+		}
+		if video, ok := byID[videoID]; ok {
+			video.Tags = append(video.Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// tagCondition limits a video query to videos carrying any, or all, of the
+// named tags.
+func tagCondition(names []string, matchAll bool) (string, []any) {
+	args := make([]any, 0, len(names)+1)
+	for _, name := range names {
+		args = append(args, name)
+	}
+	condition := `id IN (
+		SELECT video_tags.video_id
+		FROM video_tags
+		JOIN tags ON tags.id = video_tags.tag_id
+		WHERE tags.name IN (` + placeholders(len(names)) + `)`
+	if matchAll {
+		condition += `
+		GROUP BY video_tags.video_id
+		HAVING COUNT(*) = ?`
+		args = append(args, len(names))
+	}
+	return condition + `)`, args
+}
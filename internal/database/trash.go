@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrashVideo moves the video to the trash, hiding it from every lookup but
+// the trash listing until it is restored or purged.
+func (c Client) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	now := timestamp()
+	query := `
+	UPDATE videos
+	SET deleted_at = ?, updated_at = ?
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.db.ExecContext(ctx, query, now, now, id)
+	return err
+}
+
+// RestoreVideo takes one of the user's videos out of the trash. It reports
+// false if the user has no such video in the trash.
+func (c Client) RestoreVideo(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL, updated_at = ?
+	WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL
+	`
+	result, err := c.db.ExecContext(ctx, query, timestamp(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ListTrashedVideos returns the user's videos in the trash, most recently
+// deleted first.
+func (c Client) ListTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	videos, err := scanVideos(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.loadTags(ctx, videos); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// ListVideosTrashedBefore returns up to limit videos of any user that went
+// to the trash before cutoff, oldest first. Passing the last video of a page
+// as after returns the next page.
+func (c Client) ListVideosTrashedBefore(ctx context.Context, cutoff time.Time, after *Video, limit int) ([]Video, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE deleted_at < ?
+	`
+	args := []any{cutoff.UTC()}
+	if after != nil && after.DeletedAt != nil {
+		query += ` AND (deleted_at > ? OR (deleted_at = ? AND id > ?))`
+		args = append(args, after.DeletedAt.UTC(), after.DeletedAt.UTC(), after.ID)
+	}
+	query += `
+	ORDER BY deleted_at, id
+	LIMIT ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// querier runs a Client's statements: the connection pool, or the
+// transaction inside withTx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const (
+	txMaxAttempts  = 4
+	txRetryBackoff = 25 * time.Millisecond
+)
+
+// WithTx runs fn in a transaction, committing when it returns nil and
+// rolling back otherwise. Every method of the Store fn receives runs in the
+// transaction; calling the outer Client from fn runs outside it and, on
+// SQLite, waits for the transaction's write lock.
+//
+// When the database reports a conflict (SQLITE_BUSY or SQLITE_LOCKED, or a
+// Postgres serialization failure or deadlock) the transaction is retried
+// from the start, so fn must not have effects outside the database. Calling
+// WithTx on a Client that is already in a transaction joins it.
+func (c Client) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return c.withTx(ctx, func(tx Client) error {
+		return fn(tx)
+	})
+}
+
+// withTx is WithTx for the Client's own methods, which need the Client.
+func (c Client) withTx(ctx context.Context, fn func(tx Client) error) error {
+	if _, ok := c.db.(*tx); ok {
+		return fn(c)
+	}
+	for attempt := 1; ; attempt++ {
+		err := c.runTx(ctx, fn)
+		if err == nil || attempt == txMaxAttempts || !isRetryableTxError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryBackoff):
+		}
+	}
+}
+
+func (c Client) runTx(ctx context.Context, fn func(tx Client) error) error {
+	t, err := c.conn.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	txClient := c
+	txClient.db = t
+	if err := fn(txClient); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func isRetryableTxError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// serialization_failure and deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
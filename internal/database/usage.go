@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+type UserUsage struct {
+	UserID           uuid.UUID `json:"user_id"`
+	StorageUsedBytes int64     `json:"storage_used_bytes"`
+	VideoCount       int       `json:"video_count"`
+	QuotaBytes       *int64    `json:"quota_bytes"`
+	QuotaVideos      *int      `json:"quota_videos"`
+}
+
+func (c Client) GetUserUsage(ctx context.Context, userID uuid.UUID) (UserUsage, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, storage_used_bytes, video_count, quota_bytes, quota_videos
+		FROM users
+		WHERE id = ?
+	`
+	var usage UserUsage
+	var id string
+	err := c.db.QueryRowContext(ctx, query, userID.String()).Scan(
+		&id,
+		&usage.StorageUsedBytes,
+		&usage.VideoCount,
+		&usage.QuotaBytes,
+		&usage.QuotaVideos,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserUsage{}, nil
+		}
+		return UserUsage{}, err
+	}
+	usage.UserID, err = uuid.Parse(id)
+	if err != nil {
+		return UserUsage{}, err
+	}
+	return usage, nil
+}
+
+// SetUserQuota overrides the deployment-wide quotas for one user. Nil values
+// fall back to the defaults again.
+func (c Client) SetUserQuota(ctx context.Context, userID uuid.UUID, quotaBytes *int64, quotaVideos *int) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET quota_bytes = ?, quota_videos = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, quotaBytes, quotaVideos, userID.String())
+	return err
+}
+
+// ReserveUserStorage adds bytes to the user's usage only if the result stays
+// within quotaBytes, so concurrent uploads can't overshoot the quota between
+// a check and an update. A quota of zero or less means unlimited.
+func (c Client) ReserveUserStorage(ctx context.Context, userID uuid.UUID, bytes, quotaBytes int64) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	// The unlimited case is left out of the SQL: Postgres would type a bare
+	// "? <= 0" parameter as a 32-bit integer, which byte quotas overflow.
+	query := `
+		UPDATE users
+		SET storage_used_bytes = storage_used_bytes + ?
+		WHERE id = ?
+	`
+	args := []any{bytes, userID.String()}
+	if quotaBytes > 0 {
+		query += ` AND storage_used_bytes + ? <= ?`
+		args = append(args, bytes, quotaBytes)
+	}
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ReserveUserVideo counts one more video for the user if that stays within
+// quotaVideos. A quota of zero or less means unlimited.
+func (c Client) ReserveUserVideo(ctx context.Context, userID uuid.UUID, quotaVideos int) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET video_count = video_count + 1
+		WHERE id = ?
+	`
+	args := []any{userID.String()}
+	if quotaVideos > 0 {
+		query += ` AND video_count + 1 <= ?`
+		args = append(args, quotaVideos)
+	}
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (c Client) AddUserStorageUsage(ctx context.Context, userID uuid.UUID, delta int64) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET storage_used_bytes = CASE
+			WHEN storage_used_bytes + ? > 0 THEN storage_used_bytes + ?
+			ELSE 0
+		END
+		WHERE id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, delta, delta, userID.String())
+	return err
+}
+
+func (c Client) AddUserVideoCount(ctx context.Context, userID uuid.UUID, delta int) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET video_count = CASE
+			WHEN video_count + ? > 0 THEN video_count + ?
+			ELSE 0
+		END
+		WHERE id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, delta, delta, userID.String())
+	return err
+}
+
+// RecalculateUsage rebuilds every user's counters from the videos they own,
+// their retained versions and their thumbnails stored in the bucket.
+func (c Client) RecalculateUsage(ctx context.Context) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET
+			video_count = (
+				SELECT COUNT(*) FROM videos WHERE videos.user_id = users.id
+			),
+			storage_used_bytes = (
+				SELECT COALESCE(SUM(vv.size_bytes), 0)
+				FROM video_versions vv
+				JOIN videos v ON v.id = vv.video_id
+				WHERE v.user_id = users.id
+			) + (
+				SELECT COALESCE(SUM(co.size_bytes), 0)
+				FROM videos v
+				JOIN content_objects co ON co.object_key = v.thumbnail_url
+				WHERE v.user_id = users.id
+			)
+	`
+	_, err := c.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientRecalculateUsage(t *testing.T) {
+	ctx := context.Background()
+	c := openClient(t, filepath.Join(t.TempDir(), "tubely.db"))
+	user := createTestUser(t, c, "walt@example.com")
+	video := createTestVideo(t, c, user.ID, "Pilot", nil)
+	createTestVideo(t, c, user.ID, "Cat's in the Bag", nil)
+
+	_, err := c.CreateVideoVersion(ctx, CreateVideoVersionParams{
+		VideoID:     video.ID,
+		ObjectKey:   "pilot.mp4",
+		SizeBytes:   100,
+		ContentType: "video/mp4",
+		AspectRatio: "landscape",
+		UploadedBy:  user.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateContentObject(ctx, CreateContentObjectParams{Hash: "thumbnail", ObjectKey: "pilot.png", SizeBytes: 7, ContentType: "image/png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := "pilot.png"
+	video.ThumbnailURL = &thumbnail
+	if err := c.UpdateVideo(ctx, video); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RecalculateUsage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := c.GetUserUsage(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.StorageUsedBytes != 107 || usage.VideoCount != 2 {
+		t.Errorf("usage = %+v, want the version and thumbnail's 107 bytes in two videos", usage)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -20,7 +21,10 @@ type CreateUserParams struct {
 	Password string `json:"password"`
 }
 
-func (c Client) GetUsers() ([]User, error) {
+func (c Client) GetUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	query := `
 		SELECT
 			id,
@@ -28,7 +32,7 @@ func (c Client) GetUsers() ([]User, error) {
 		FROM users
 	`
 
-	rows, err := c.db.Query(query)
+	rows, err := c.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +55,10 @@ func (c Client) GetUsers() ([]User, error) {
 	return users, nil
 }
 
-func (c Client) GetUserByEmail(email string) (User, error) {
+func (c Client) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, created_at, updated_at, email, password
 		FROM users
@@ -59,7 +66,7 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	`
 	var user User
 	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.db.QueryRowContext(ctx, query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, nil
@@ -73,7 +80,10 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
-func (c Client) GetUserByRefreshToken(token string) (*User, error) {
+func (c Client) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	query := `
 		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
 		FROM users u
@@ -83,7 +93,7 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 
 	var user User
 	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	err := c.db.QueryRowContext(ctx, query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -98,7 +108,10 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) CreateUser(params CreateUserParams) (*User, error) {
+func (c Client) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	id := uuid.New()
 
 	query := `
@@ -107,15 +120,18 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 		VALUES
 		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password)
+	_, err := c.db.ExecContext(ctx, query, id.String(), params.Email, params.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.GetUser(id)
+	return c.GetUser(ctx, id)
 }
 
-func (c Client) GetUser(id uuid.UUID) (*User, error) {
+func (c Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, created_at, updated_at, email, password
 		FROM users
@@ -123,7 +139,7 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	`
 	var user User
 	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.db.QueryRowContext(ctx, query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -137,11 +153,118 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) DeleteUser(id uuid.UUID) error {
+// DeleteUser removes a user along with their refresh tokens, tags, videos
+// and video versions in one transaction. The references those versions and
+// thumbnails held on content objects are released in it too, and the keys
+// of objects left with none are returned for the caller to delete from
+// storage.
+func (c Client) DeleteUser(ctx context.Context, id uuid.UUID) ([]string, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	userID := id.String()
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM refresh_tokens WHERE user_id = ?`, []any{userID}},
+		{`DELETE FROM video_versions
+		WHERE uploaded_by = ? OR video_id IN (SELECT id FROM videos WHERE user_id = ?)`, []any{userID, userID}},
+		{`DELETE FROM video_tags
+		WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`, []any{userID}},
+		{`DELETE FROM tags WHERE user_id = ?`, []any{userID}},
+		{`DELETE FROM videos WHERE user_id = ?`, []any{userID}},
+		{`DELETE FROM users WHERE id = ?`, []any{userID}},
+	}
+	var unreferenced []string
+	err := c.withTx(ctx, func(tx Client) error {
+		unreferenced = nil
+		keys, err := tx.userObjectKeys(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			remaining, err := tx.ReleaseContentObject(ctx, key)
+			if err != nil {
+				return err
+			}
+			if remaining == 0 {
+				unreferenced = append(unreferenced, key)
+			}
+		}
+		for _, statement := range statements {
+			if _, err := tx.db.ExecContext(ctx, statement.query, statement.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unreferenced, nil
+}
+
+// userObjectKeys lists the content object keys the user's video versions
+// and thumbnails refer to, once per reference.
+func (c Client) userObjectKeys(ctx context.Context, userID string) ([]string, error) {
+	query := `
+	SELECT o.object_key
+	FROM video_versions v
+	JOIN content_objects o ON o.object_key = v.object_key
+	WHERE v.uploaded_by = ? OR v.video_id IN (SELECT id FROM videos WHERE user_id = ?)
+	UNION ALL
+	SELECT o.object_key
+	FROM videos v
+	JOIN content_objects o ON o.object_key = v.thumbnail_url
+	WHERE v.user_id = ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c Client) GetUserVideoVersionLimit(ctx context.Context, id uuid.UUID) (*int, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT video_version_limit
+		FROM users
+		WHERE id = ?
+	`
+	var limit *int
+	err := c.db.QueryRowContext(ctx, query, id.String()).Scan(&limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return limit, nil
+}
+
+func (c Client) SetUserVideoVersionLimit(ctx context.Context, id uuid.UUID, limit *int) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	query := `
-		DELETE FROM users
+		UPDATE users
+		SET video_version_limit = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
+	_, err := c.db.ExecContext(ctx, query, limit, id.String())
 	return err
 }
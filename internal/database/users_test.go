@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClientDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	c := openClient(t, filepath.Join(t.TempDir(), "tubely.db"))
+	walt := createTestUser(t, c, "walt@example.com")
+	jesse := createTestUser(t, c, "jesse@example.com")
+
+	// Both users uploaded the same video, so its object outlives Walt; his
+	// thumbnail is his alone.
+	upload := func(user User, title string) Video {
+		t.Helper()
+		video := createTestVideo(t, c, user.ID, title, nil)
+		_, err := c.CreateContentObject(ctx, CreateContentObjectParams{Hash: "video", ObjectKey: "shared.mp4", SizeBytes: 1, ContentType: "video/mp4"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.CreateVideoVersion(ctx, CreateVideoVersionParams{
+			VideoID:     video.ID,
+			ObjectKey:   "shared.mp4",
+			SizeBytes:   1,
+			ContentType: "video/mp4",
+			AspectRatio: "landscape",
+			UploadedBy:  user.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return video
+	}
+	video := upload(walt, "Pilot")
+	upload(jesse, "Pilot (copy)")
+	if _, err := c.CreateContentObject(ctx, CreateContentObjectParams{Hash: "thumbnail", ObjectKey: "thumbnail.png", SizeBytes: 1, ContentType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := "thumbnail.png"
+	video.ThumbnailURL = &thumbnail
+	if err := c.UpdateVideo(ctx, video); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetVideoTags(ctx, video.ID, []string{"drama"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "token", UserID: walt.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unreferenced, err := c.DeleteUser(ctx, walt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(unreferenced, []string{"thumbnail.png"}) {
+		t.Errorf("DeleteUser = %q, want only the thumbnail unreferenced", unreferenced)
+	}
+	if user, err := c.GetUser(ctx, walt.ID); err != nil || user != nil {
+		t.Errorf("GetUser after DeleteUser = %+v, %v, want none", user, err)
+	}
+	if obj, err := c.GetContentObject(ctx, "video", nil); err != nil || obj.RefCount != 1 {
+		t.Errorf("shared object = %+v, %v, want Jesse's reference left", obj, err)
+	}
+	if obj, err := c.GetContentObject(ctx, "thumbnail", nil); err != nil || obj.ObjectKey != "" {
+		t.Errorf("thumbnail object = %+v, %v, want it gone", obj, err)
+	}
+	videos, _, err := c.ListVideos(ctx, ListVideosParams{UserID: jesse.ID, Sort: VideoSortCreated, Limit: 10})
+	if err != nil || len(videos) != 1 {
+		t.Errorf("Jesse's videos = %+v, %v, want the copy kept", videos, err)
+	}
+}
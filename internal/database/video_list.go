@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoSort string
+
+const (
+	VideoSortCreated  VideoSort = "created"
+	VideoSortUpdated  VideoSort = "updated"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+)
+
+// videoSortColumns are the expressions each sort orders by, with the video
+// ID breaking ties. Videos without a duration sort as zero length.
+var videoSortColumns = map[VideoSort]string{
+	VideoSortCreated:  "created_at",
+	VideoSortUpdated:  "updated_at",
+	VideoSortTitle:    "title",
+	VideoSortDuration: "COALESCE(duration_seconds, 0)",
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListVideosParams selects one page of a user's videos. Nil filters match
+// every video. CreatedAfter is inclusive and CreatedBefore exclusive.
+type ListVideosParams struct {
+	UserID        uuid.UUID
+	Sort          VideoSort
+	Descending    bool
+	Limit         int
+	Cursor        *VideoCursor
+	HasVideo      *bool
+	HasThumbnail  *bool
+	Orientation   *string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Tags keeps videos carrying any of the tags, or all of them when
+	// MatchAllTags is set.
+	Tags         []string
+	MatchAllTags bool
+}
+
+// VideoCursor is the position of the last video on a page: its sort value
+// and ID, along with the sort it belongs to.
+type VideoCursor struct {
+	Sort       VideoSort `json:"s"`
+	Descending bool      `json:"d"`
+	Value      string    `json:"v"`
+	ID         uuid.UUID `json:"id"`
+}
+
+// Encode renders the cursor as an opaque URL-safe token.
+func (vc VideoCursor) Encode() string {
+	data, _ := json.Marshal(vc)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeVideoCursor(token string) (VideoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	var vc VideoCursor
+	if err := json.Unmarshal(data, &vc); err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	if _, err := vc.sortValue(); err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	return vc, nil
+}
+
+// videoCursorAt is the cursor that continues a listing after video.
+func videoCursorAt(params ListVideosParams, video Video) VideoCursor {
+	vc := VideoCursor{Sort: params.Sort, Descending: params.Descending, ID: video.ID}
+	switch params.Sort {
+	case VideoSortCreated:
+		vc.Value = video.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case VideoSortUpdated:
+		vc.Value = video.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case VideoSortTitle:
+		vc.Value = video.Title
+	case VideoSortDuration:
+		vc.Value = strconv.FormatFloat(videoDuration(video), 'g', -1, 64)
+	}
+	return vc
+}
+
+func videoDuration(video Video) float64 {
+	if video.DurationSeconds == nil {
+		return 0
+	}
+	return *video.DurationSeconds
+}
+
+// sortValue parses the cursor's value into the type its sort column holds.
+func (vc VideoCursor) sortValue() (any, error) {
+	switch vc.Sort {
+	case VideoSortCreated, VideoSortUpdated:
+		return time.Parse(time.RFC3339Nano, vc.Value)
+	case VideoSortTitle:
+		return vc.Value, nil
+	case VideoSortDuration:
+		return strconv.ParseFloat(vc.Value, 64)
+	default:
+		return nil, fmt.Errorf("unknown sort %q", vc.Sort)
+	}
+}
+
+// ListVideos returns a page of the user's videos and the cursor for the next
+// page, which is nil on the last one. Pages are keyed on (sort value, ID),
+// so videos added or changed between requests don't shift later pages.
+func (c Client) ListVideos(ctx context.Context, params ListVideosParams) ([]Video, *VideoCursor, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	column, ok := videoSortColumns[params.Sort]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown sort %q", params.Sort)
+	}
+	direction, comparison := "ASC", ">"
+	if params.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []any{params.UserID}
+	if params.HasVideo != nil {
+		conditions = append(conditions, nullCondition("video_url", *params.HasVideo))
+	}
+	if params.HasThumbnail != nil {
+		conditions = append(conditions, nullCondition("thumbnail_url", *params.HasThumbnail))
+	}
+	if params.Orientation != nil {
+		conditions = append(conditions, "orientation = ?")
+		args = append(args, *params.Orientation)
+	}
+	if params.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, params.CreatedAfter.UTC())
+	}
+	if params.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, params.CreatedBefore.UTC())
+	}
+	if len(params.Tags) > 0 {
+		condition, tagArgs := tagCondition(params.Tags, params.MatchAllTags)
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+	if params.Cursor != nil {
+		if params.Cursor.Sort != params.Sort || params.Cursor.Descending != params.Descending {
+			return nil, nil, fmt.Errorf("%w: it belongs to a listing with a different sort", ErrInvalidCursor)
+		}
+		value, err := params.Cursor.sortValue()
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC()
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, comparison,
+		))
+		args = append(args, value, value, params.Cursor.ID)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM videos WHERE %s ORDER BY %s %s, id %s LIMIT ?`,
+		videoColumns, strings.Join(conditions, " AND "), column, direction, direction,
+	)
+	// One extra row tells whether there is a next page.
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	videos, err := scanVideos(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	videos, next, err := pageOfVideos(params, videos)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.loadTags(ctx, videos); err != nil {
+		return nil, nil, err
+	}
+	return videos, next, nil
+}
+
+func nullCondition(column string, present bool) string {
+	if present {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
+
+func pageOfVideos(params ListVideosParams, videos []Video) ([]Video, *VideoCursor, error) {
+	if len(videos) <= params.Limit {
+		return videos, nil, nil
+	}
+	videos = videos[:params.Limit]
+	next := videoCursorAt(params, videos[len(videos)-1])
+	return videos, &next, nil
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// maxSearchTerms caps how many words of a search query are matched.
+const maxSearchTerms = 16
+
+type SearchVideosParams struct {
+	UserID uuid.UUID
+	// Query is the text the user typed. Every word must match, either whole
+	// or as the prefix of a word in the title or description.
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// VideoSearchResult is a matching video with its relevance (higher is
+// better, comparable only within one search) and excerpts where the matched
+// words are wrapped in <mark>. The excerpts are HTML-escaped.
+type VideoSearchResult struct {
+	Video              Video   `json:"video"`
+	Score              float64 `json:"score"`
+	TitleHighlight     string  `json:"title_highlight"`
+	DescriptionSnippet string  `json:"description_snippet"`
+}
+
+// The search engines mark matches with these private-use runes, which are
+// swapped for <mark> tags once the rest of the text has been escaped.
+const (
+	matchStart = "\ue000"
+	matchEnd   = "\ue001"
+)
+
+// SearchTerms splits a query into the words it matches on, dropping
+// punctuation and search syntax.
+func SearchTerms(query string) []string {
+	terms := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// SearchVideos returns the user's videos matching the query, best match
+// first. A query without any words matches nothing.
+//
+// SQLite without the FTS5 search index falls back to LIKE, which matches
+// each word anywhere in the title or description, not just at the start of
+// a word, and scores a video by how many words its title and description
+// contain.
+func (c Client) SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return []VideoSearchResult{}, nil
+	}
+
+	useLike := false
+	if c.conn.dialect == dialectSQLite {
+		indexed, err := c.hasSearchIndex(ctx)
+		if err != nil {
+			return nil, err
+		}
+		useLike = !indexed
+	}
+
+	var query string
+	var args []any
+	switch {
+	case useLike:
+		var score, conditions []string
+		for _, term := range terms {
+			pattern := "%" + term + "%"
+			score = append(score, `CASE WHEN title LIKE ? THEN 10 ELSE 0 END + CASE WHEN description LIKE ? THEN 1 ELSE 0 END`)
+			conditions = append(conditions, `(title LIKE ? OR description LIKE ?)`)
+			args = append(args, pattern, pattern)
+		}
+		// The score placeholders come first, so the patterns go in twice.
+		args = append(args, args...)
+		query = `
+		SELECT ` + videoColumns + `, ` + strings.Join(score, " + ") + ` AS score
+		FROM videos
+		WHERE ` + strings.Join(conditions, " AND ") + ` AND user_id = ? AND deleted_at IS NULL
+		ORDER BY score DESC, id
+		LIMIT ? OFFSET ?
+		`
+	case c.conn.dialect == dialectPostgres:
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		query = `
+		SELECT ` + videoColumns + `,
+			ts_rank(search_vector, q) AS score,
+			ts_headline('english', title, q, ?),
+			ts_headline('english', COALESCE(description, ''), q, ?)
+		FROM videos, to_tsquery('english', ?) AS q
+		WHERE user_id = ? AND deleted_at IS NULL AND search_vector @@ q
+		ORDER BY score DESC, id
+		LIMIT ? OFFSET ?
+		`
+		args = []any{
+			"HighlightAll=true, StartSel=" + matchStart + ", StopSel=" + matchEnd,
+			"MaxWords=24, MinWords=12, MaxFragments=2, FragmentDelimiter=\" … \", StartSel=" + matchStart + ", StopSel=" + matchEnd,
+			strings.Join(prefixes, " & "),
+		}
+	default:
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = `"` + term + `"*`
+		}
+		// bm25 is lower for better matches, and weighs title matches above
+		// description ones. The video_id column has no weight.
+		query = `
+		SELECT ` + videoColumns + `, matches.score, matches.title_highlight, matches.description_snippet
+		FROM (
+			SELECT
+				video_id,
+				-bm25(videos_fts, 0.0, 10.0, 1.0) AS score,
+				highlight(videos_fts, 1, ?, ?) AS title_highlight,
+				snippet(videos_fts, 2, ?, ?, '…', 24) AS description_snippet
+			FROM videos_fts
+			WHERE videos_fts MATCH ?
+		) AS matches
+		JOIN videos ON videos.id = matches.video_id
+		WHERE user_id = ? AND deleted_at IS NULL
+		ORDER BY matches.score DESC, id
+		LIMIT ? OFFSET ?
+		`
+		args = []any{matchStart, matchEnd, matchStart, matchEnd, strings.Join(prefixes, " ")}
+	}
+	args = append(args, params.UserID, params.Limit, params.Offset)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		if useLike {
+			result.Video, err = scanVideo(rows, &result.Score)
+			result.TitleHighlight = highlightTerms(result.Video.Title, terms)
+			if result.Video.Description != nil {
+				result.DescriptionSnippet = highlightTerms(snippetAround(*result.Video.Description, terms), terms)
+			}
+		} else {
+			result.Video, err = scanVideo(rows, &result.Score, &result.TitleHighlight, &result.DescriptionSnippet)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.TitleHighlight = markMatches(result.TitleHighlight)
+		result.DescriptionSnippet = markMatches(result.DescriptionSnippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	videos := make([]Video, len(results))
+	for i, result := range results {
+		videos[i] = result.Video
+	}
+	if err := c.loadTags(ctx, videos); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Video = videos[i]
+	}
+	return results, nil
+}
+
+// hasSearchIndex reports whether the SQLite database has the FTS5 index
+// migration 0004 creates. Builds without FTS5 leave that migration pending.
+func (c Client) hasSearchIndex(ctx context.Context) (bool, error) {
+	var count int
+	err := c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'videos_fts'`).Scan(&count)
+	return count > 0, err
+}
+
+// termsPattern matches any of the terms, ignoring case.
+func termsPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+}
+
+// highlightTerms wraps every occurrence of the terms in the match markers,
+// the way the search engines highlight their matches.
+func highlightTerms(text string, terms []string) string {
+	return termsPattern(terms).ReplaceAllString(text, matchStart+"$0"+matchEnd)
+}
+
+// snippetAround cuts text down to about 24 words around the first match, as
+// the search engines' snippets do.
+func snippetAround(text string, terms []string) string {
+	const snippetWords = 24
+	words := strings.Fields(text)
+	if len(words) <= snippetWords {
+		return text
+	}
+	pattern := termsPattern(terms)
+	first := 0
+	for i, word := range words {
+		if pattern.MatchString(word) {
+			first = i
+			break
+		}
+	}
+	start := max(0, min(first-snippetWords/4, len(words)-snippetWords))
+	end := start + snippetWords
+	snippet := strings.Join(words[start:end], " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+func markMatches(text string) string {
+	return strings.NewReplacer(matchStart, "<mark>", matchEnd, "</mark>").Replace(html.EscapeString(text))
+}
@@ -0,0 +1,275 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoVersion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version"`
+	CreateVideoVersionParams
+}
+
+type CreateVideoVersionParams struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	ObjectKey   string    `json:"object_key"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ContentType string    `json:"content_type"`
+	AspectRatio string    `json:"aspect_ratio"`
+	UploadedBy  uuid.UUID `json:"uploaded_by"`
+	// ChecksumSHA256 is the base64 SHA-256 of the plaintext video, which
+	// differs from the checksum S3 reports for an encrypted object.
+	ChecksumSHA256  string   `json:"checksum_sha256"`
+	DurationSeconds *float64 `json:"duration_seconds"`
+}
+
+func (c Client) CreateVideoVersion(ctx context.Context, params CreateVideoVersionParams) (VideoVersion, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	id := uuid.New()
+	query := `
+	INSERT INTO video_versions (
+		id,
+		created_at,
+		video_id,
+		version,
+		object_key,
+		size_bytes,
+		content_type,
+		aspect_ratio,
+		uploaded_by,
+		checksum_sha256,
+		duration_seconds
+	) VALUES (
+		?,
+		CURRENT_TIMESTAMP,
+		?,
+		(SELECT COALESCE(MAX(version), 0) + 1 FROM video_versions WHERE video_id = ?),
+		?, ?, ?, ?, ?, ?, ?
+	)
+	`
+	_, err := c.db.ExecContext(ctx,
+		query,
+		id,
+		params.VideoID,
+		params.VideoID,
+		params.ObjectKey,
+		params.SizeBytes,
+		params.ContentType,
+		params.AspectRatio,
+		params.UploadedBy,
+		params.ChecksumSHA256,
+		params.DurationSeconds,
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	return c.getVideoVersionByID(ctx, id)
+}
+
+func (c Client) GetVideoVersions(ctx context.Context, videoID uuid.UUID) ([]VideoVersion, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		object_key,
+		size_bytes,
+		content_type,
+		aspect_ratio,
+		uploaded_by,
+		COALESCE(checksum_sha256, ''),
+		duration_seconds
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		var version VideoVersion
+		if err := rows.Scan(
+			&version.ID,
+			&version.CreatedAt,
+			&version.VideoID,
+			&version.Version,
+			&version.ObjectKey,
+			&version.SizeBytes,
+			&version.ContentType,
+			&version.AspectRatio,
+			&version.UploadedBy,
+			&version.ChecksumSHA256,
+			&version.DurationSeconds,
+		); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetAllVideoVersions returns the versions of every video, oldest first, for
+// maintenance commands.
+func (c Client) GetAllVideoVersions(ctx context.Context) ([]VideoVersion, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		object_key,
+		size_bytes,
+		content_type,
+		aspect_ratio,
+		uploaded_by,
+		COALESCE(checksum_sha256, ''),
+		duration_seconds
+	FROM video_versions
+	ORDER BY created_at, version
+	`
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		var version VideoVersion
+		if err := rows.Scan(
+			&version.ID,
+			&version.CreatedAt,
+			&version.VideoID,
+			&version.Version,
+			&version.ObjectKey,
+			&version.SizeBytes,
+			&version.ContentType,
+			&version.AspectRatio,
+			&version.UploadedBy,
+			&version.ChecksumSHA256,
+			&version.DurationSeconds,
+		); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+func (c Client) GetVideoVersion(ctx context.Context, videoID uuid.UUID, version int) (VideoVersion, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		object_key,
+		size_bytes,
+		content_type,
+		aspect_ratio,
+		uploaded_by,
+		COALESCE(checksum_sha256, ''),
+		duration_seconds
+	FROM video_versions
+	WHERE video_id = ? AND version = ?
+	`
+	return c.scanVideoVersion(c.db.QueryRowContext(ctx, query, videoID, version))
+}
+
+func (c Client) getVideoVersionByID(ctx context.Context, id uuid.UUID) (VideoVersion, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		object_key,
+		size_bytes,
+		content_type,
+		aspect_ratio,
+		uploaded_by,
+		COALESCE(checksum_sha256, ''),
+		duration_seconds
+	FROM video_versions
+	WHERE id = ?
+	`
+	return c.scanVideoVersion(c.db.QueryRowContext(ctx, query, id))
+}
+
+func (c Client) scanVideoVersion(row *sql.Row) (VideoVersion, error) {
+	var version VideoVersion
+	err := row.Scan(
+		&version.ID,
+		&version.CreatedAt,
+		&version.VideoID,
+		&version.Version,
+		&version.ObjectKey,
+		&version.SizeBytes,
+		&version.ContentType,
+		&version.AspectRatio,
+		&version.UploadedBy,
+		&version.ChecksumSHA256,
+		&version.DurationSeconds,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+	return version, nil
+}
+
+func (c Client) DeleteVideoVersion(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	DELETE FROM video_versions
+	WHERE id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (c Client) DeleteVideoVersions(ctx context.Context, videoID uuid.UUID) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	DELETE FROM video_versions
+	WHERE video_id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, videoID)
+	return err
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -9,65 +10,110 @@ import (
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ThumbnailURL   *string   `json:"thumbnail_url"`
+	VideoURL       *string   `json:"video_url"`
+	CurrentVersion *int      `json:"current_version"`
+	// VideoChecksumSHA256 is the base64 SHA-256 of the video as uploaded
+	// and served. It matches S3's x-amz-checksum-sha256 header only when the
+	// object isn't encrypted; for encrypted objects S3 holds the ciphertext.
+	VideoChecksumSHA256 *string `json:"video_checksum_sha256"`
+	// EncryptionKeyID names the master key that wraps the data key of the
+	// current video object, or is nil when the object isn't encrypted.
+	EncryptionKeyID *string `json:"encryption_key_id"`
+	// DurationSeconds and Orientation ("landscape", "portrait" or "other")
+	// describe the current video object, and are nil until one is uploaded.
+	// Videos uploaded before durations were recorded have none.
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Orientation     *string  `json:"orientation"`
+	// DeletedAt is set while the video is in the trash.
+	DeletedAt *time.Time `json:"deleted_at"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
+	Title string `json:"title"`
+	// Description is nil when the video has none.
+	Description *string   `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	// Tags are normalized and distinct, and sorted when read back.
+	Tags []string `json:"tags"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+const videoColumns = `
+	id,
+	created_at,
+	updated_at,
+	title,
+	description,
+	thumbnail_url,
+	video_url,
+	current_version,
+	video_checksum_sha256,
+	encryption_key_id,
+	duration_seconds,
+	orientation,
+	deleted_at,
+	user_id
+`
 
-	rows, err := c.db.Query(query, userID)
-	if err != nil {
-		return nil, err
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanVideo reads the videoColumns of a row, followed by any extra columns
+// the query selected.
+func scanVideo(row rowScanner, extra ...any) (Video, error) {
+	var video Video
+	dest := []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.CurrentVersion,
+		&video.VideoChecksumSHA256,
+		&video.EncryptionKeyID,
+		&video.DurationSeconds,
+		&video.Orientation,
+		&video.DeletedAt,
+		&video.UserID,
 	}
+	err := row.Scan(append(dest, extra...)...)
+	return video, err
+}
+
+func scanVideos(rows *sql.Rows) ([]Video, error) {
 	defer rows.Close()
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	return videos, rows.Err()
+}
 
-	return videos, nil
+// timestamp is the time written to created_at and updated_at. Truncating to
+// microseconds matches what PostgreSQL stores, so a time read back compares
+// equal to the stored one, which list cursors rely on.
+func timestamp() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	id := uuid.New()
+	now := timestamp()
 	query := `
 	INSERT INTO videos (
 		id,
@@ -76,41 +122,31 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		title,
 		description,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
-	if err != nil {
-		return Video{}, err
-	}
-
-	return c.GetVideo(id)
+	var video Video
+	err := c.withTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, query, id, now, now, params.Title, params.Description, params.UserID)
+		if err != nil {
+			return err
+		}
+		if len(params.Tags) > 0 {
+			if err := tx.setVideoTags(ctx, id, params.Tags); err != nil {
+				return err
+			}
+		}
+		video, err = tx.GetVideo(ctx, id)
+		return err
+	})
+	return video, err
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
-	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE id = ?
-	`
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	query := `SELECT ` + videoColumns + ` FROM videos WHERE id = ? AND deleted_at IS NULL`
+	video, err := scanVideo(c.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,38 +154,186 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
-	return video, nil
+	videos := []Video{video}
+	if err := c.loadTags(ctx, videos); err != nil {
+		return Video{}, err
+	}
+	return videos[0], nil
+}
+
+var ErrVideoModified = errors.New("video was modified")
+
+// UpdateVideo saves every field of the video but its tags, which
+// SetVideoTags changes, and bumps its updated_at.
+func (c Client) UpdateVideo(ctx context.Context, video Video) error {
+	_, err := c.updateVideo(ctx, video, false)
+	return err
+}
+
+// UpdateVideoIfUnchanged is UpdateVideo for a video read at its UpdatedAt.
+// It returns ErrVideoModified, saving nothing, if the video has been updated
+// or deleted since.
+func (c Client) UpdateVideoIfUnchanged(ctx context.Context, video Video) error {
+	updated, err := c.updateVideo(ctx, video, true)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrVideoModified
+	}
+	return nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
+func (c Client) updateVideo(ctx context.Context, video Video, ifUnchanged bool) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
 	query := `
 	UPDATE videos
 	SET
+		updated_at = ?,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
+		current_version = ?,
+		video_checksum_sha256 = ?,
+		encryption_key_id = ?,
+		duration_seconds = ?,
+		orientation = ?,
 		user_id = ?
 	WHERE id = ?
 	`
-
-	_, err := c.db.Exec(
-		query,
+	args := []any{
+		timestamp(),
 		video.Title,
 		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
+		video.ThumbnailURL,
+		video.VideoURL,
+		video.CurrentVersion,
+		video.VideoChecksumSHA256,
+		video.EncryptionKeyID,
+		video.DurationSeconds,
+		video.Orientation,
 		video.UserID,
 		video.ID,
-	)
-	return err
+	}
+	if ifUnchanged {
+		query += ` AND updated_at = ?`
+		args = append(args, video.UpdatedAt.UTC())
+	}
+
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
-	query := `
-	DELETE FROM videos
-	WHERE id = ?
-	`
-	_, err := c.db.Exec(query, id)
-	return err
+// SetVideoURLIfUnchanged points the video at newURL if its video_url is
+// still oldURL, and reports whether it was. Unlike UpdateVideo it leaves the
+// rest of the row alone, so it can't undo changes made since oldURL was read.
+func (c Client) SetVideoURLIfUnchanged(ctx context.Context, id uuid.UUID, oldURL, newURL string) (bool, error) {
+	return c.setVideoColumnIfUnchanged(ctx, "video_url", id, oldURL, newURL)
+}
+
+// SetThumbnailURLIfUnchanged is SetVideoURLIfUnchanged for thumbnail_url.
+func (c Client) SetThumbnailURLIfUnchanged(ctx context.Context, id uuid.UUID, oldURL, newURL string) (bool, error) {
+	return c.setVideoColumnIfUnchanged(ctx, "thumbnail_url", id, oldURL, newURL)
+}
+
+func (c Client) setVideoColumnIfUnchanged(ctx context.Context, column string, id uuid.UUID, oldValue, newValue string) (bool, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `UPDATE videos SET ` + column + ` = ?, updated_at = ? WHERE id = ? AND ` + column + ` = ?`
+	result, err := c.db.ExecContext(ctx, query, newValue, timestamp(), id, oldValue)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+var ErrVideoNotTrashed = errors.New("video is not in the trash")
+
+// DeleteVideo removes the video, whether or not it's in the trash, along
+// with its versions and tags.
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	return c.deleteVideo(ctx, id, false)
+}
+
+// DeleteTrashedVideo is DeleteVideo for a video in the trash. If the video
+// was restored or is gone it returns ErrVideoNotTrashed, which must roll
+// back any transaction it runs in.
+func (c Client) DeleteTrashedVideo(ctx context.Context, id uuid.UUID) error {
+	return c.deleteVideo(ctx, id, true)
+}
+
+func (c Client) deleteVideo(ctx context.Context, id uuid.UUID, trashedOnly bool) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.withTx(ctx, func(tx Client) error {
+		err := tx.DeleteVideoVersions(ctx, id)
+		if err != nil {
+			return err
+		}
+		var userID uuid.UUID
+		err = tx.db.QueryRowContext(ctx, `SELECT user_id FROM videos WHERE id = ?`, id).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			if trashedOnly {
+				return ErrVideoNotTrashed
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, `DELETE FROM video_tags WHERE video_id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		query := `
+		DELETE FROM videos
+		WHERE id = ?
+		`
+		if trashedOnly {
+			query += ` AND deleted_at IS NOT NULL`
+		}
+		result, err := tx.db.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 && trashedOnly {
+			return ErrVideoNotTrashed
+		}
+		return tx.deleteUnusedTags(ctx, userID)
+	})
+}
+
+// GetAllVideos returns every video regardless of owner, including those in
+// the trash and without their tags, for maintenance commands.
+func (c Client) GetAllVideos(ctx context.Context) ([]Video, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	query := `SELECT ` + videoColumns + ` FROM videos ORDER BY created_at`
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
 }
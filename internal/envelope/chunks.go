@@ -0,0 +1,193 @@
+package envelope
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Objects are encrypted in fixed-size chunks, each sealed with AES-GCM under
+// the object's data key, so any byte range can be decrypted by fetching only
+// the chunks that cover it. The chunk index is the nonce and, together with
+// a flag marking the last chunk, the additional data, which stops chunks
+// from being reordered, dropped or the object from being truncated.
+const (
+	ChunkSize = 64 << 10
+	overhead  = 16
+)
+
+// CiphertextSize is the size of the encrypted object for plaintextSize bytes.
+func CiphertextSize(plaintextSize int64) int64 {
+	return plaintextSize + chunkCount(plaintextSize)*overhead
+}
+
+// chunkCount includes the single empty chunk an empty object is stored as.
+func chunkCount(plaintextSize int64) int64 {
+	return max(1, (plaintextSize+ChunkSize-1)/ChunkSize)
+}
+
+func chunkNonce(index int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+func chunkAD(index int64, final bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, uint64(index))
+	if final {
+		ad[8] = 1
+	}
+	return ad
+}
+
+// Encrypt writes src to dst encrypted with dataKey.
+func Encrypt(dst io.Writer, src io.Reader, dataKey []byte) error {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	current := make([]byte, ChunkSize)
+	next := make([]byte, ChunkSize)
+	sealed := make([]byte, 0, ChunkSize+overhead)
+
+	n, err := readChunk(src, current)
+	if err != nil {
+		return err
+	}
+	for index := int64(0); ; index++ {
+		// Read ahead to learn whether this chunk is the last one.
+		m, err := readChunk(src, next)
+		if err != nil {
+			return err
+		}
+		final := m == 0
+		sealed = aead.Seal(sealed[:0], chunkNonce(index), current[:n], chunkAD(index, final))
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+		current, next = next, current
+		n = m
+	}
+}
+
+func readChunk(src io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(src, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	return n, err
+}
+
+// RangeOpener returns the encrypted object starting at offset.
+type RangeOpener func(offset int64) (io.ReadCloser, error)
+
+// Reader decrypts an object as an io.ReadSeeker, fetching it from the chunk
+// that holds the current position onwards, so it can back
+// http.ServeContent and answer range requests.
+type Reader struct {
+	open  RangeOpener
+	aead  cipher.AEAD
+	size  int64
+	chunk []byte
+
+	offset int64
+	body   io.ReadCloser
+	// nextChunk is the index of the chunk body is positioned at.
+	nextChunk int64
+	plain     []byte
+}
+
+// NewReader decrypts an object of plaintextSize bytes that was encrypted
+// with dataKey.
+func NewReader(open RangeOpener, dataKey []byte, plaintextSize int64) (*Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		open:  open,
+		aead:  aead,
+		size:  plaintextSize,
+		chunk: make([]byte, ChunkSize+overhead),
+	}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if len(r.plain) == 0 {
+		if err := r.decryptChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *Reader) decryptChunk() error {
+	index := r.offset / ChunkSize
+	if r.body == nil || r.nextChunk != index {
+		r.closeBody()
+		body, err := r.open(index * (ChunkSize + overhead))
+		if err != nil {
+			return err
+		}
+		r.body = body
+		r.nextChunk = index
+	}
+
+	plainLen := min(ChunkSize, r.size-index*ChunkSize)
+	sealed := r.chunk[:plainLen+overhead]
+	if _, err := io.ReadFull(r.body, sealed); err != nil {
+		return fmt.Errorf("couldn't read chunk %d: %w", index, err)
+	}
+	final := index == chunkCount(r.size)-1
+	plain, err := r.aead.Open(sealed[:0], chunkNonce(index), sealed, chunkAD(index, final))
+	if err != nil {
+		return fmt.Errorf("couldn't decrypt chunk %d: %w", index, err)
+	}
+	r.nextChunk++
+	r.plain = plain[r.offset-index*ChunkSize:]
+	return nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != r.offset {
+		r.offset = offset
+		r.plain = nil
+	}
+	return offset, nil
+}
+
+func (r *Reader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+func (r *Reader) Close() error {
+	r.closeBody()
+	return nil
+}
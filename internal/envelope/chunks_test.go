@@ -0,0 +1,166 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+)
+
+// encrypted returns size random bytes and their encryption under a new data
+// key.
+func encrypted(t *testing.T, size int) (plain, sealed, dataKey []byte) {
+	t.Helper()
+
+	plain = make([]byte, size)
+	if _, err := rand.Read(plain); err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encrypt(&buf, bytes.NewReader(plain), dataKey); err != nil {
+		t.Fatal(err)
+	}
+	if int64(buf.Len()) != CiphertextSize(int64(size)) {
+		t.Fatalf("ciphertext is %d bytes, CiphertextSize says %d", buf.Len(), CiphertextSize(int64(size)))
+	}
+	return plain, buf.Bytes(), dataKey
+}
+
+// opener serves sealed like a ranged GET, counting the requests.
+func opener(sealed []byte, opens *int) RangeOpener {
+	return func(offset int64) (io.ReadCloser, error) {
+		*opens++
+		return io.NopCloser(bytes.NewReader(sealed[offset:])), nil
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 100} {
+		plain, sealed, dataKey := encrypted(t, size)
+		var opens int
+		r, err := NewReader(opener(sealed, &opens), dataKey, int64(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("reading %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("round trip of %d bytes returned different bytes", size)
+		}
+		if size > 0 && opens != 1 {
+			t.Errorf("reading %d bytes in order opened the object %d times, want once", size, opens)
+		}
+	}
+}
+
+func TestSeekAcrossChunks(t *testing.T) {
+	size := 3*ChunkSize + 100
+	plain, sealed, dataKey := encrypted(t, size)
+	var opens int
+	r, err := NewReader(opener(sealed, &opens), dataKey, int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := []struct {
+		offset int64
+		whence int
+		start  int
+		length int
+	}{
+		{10, io.SeekStart, 10, 20},
+		{ChunkSize - 5, io.SeekStart, ChunkSize - 5, 10},                 // straddles chunks 0 and 1
+		{2*ChunkSize + 7, io.SeekStart, 2*ChunkSize + 7, ChunkSize + 93}, // runs to the end
+		{-50, io.SeekEnd, size - 50, 50},
+		{-ChunkSize - 50, io.SeekCurrent, size - ChunkSize - 50, 60},
+	}
+	for _, rng := range ranges {
+		pos, err := r.Seek(rng.offset, rng.whence)
+		if err != nil || pos != int64(rng.start) {
+			t.Fatalf("Seek(%d, %d) = %d, %v, want %d", rng.offset, rng.whence, pos, err, rng.start)
+		}
+		got := make([]byte, rng.length)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("reading %d bytes at %d: %v", rng.length, rng.start, err)
+		}
+		if !bytes.Equal(got, plain[rng.start:rng.start+rng.length]) {
+			t.Errorf("bytes %d-%d differ from the plaintext", rng.start, rng.start+rng.length)
+		}
+	}
+	if _, err := r.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read past the end = %d, %v, want io.EOF", n, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek to a negative position succeeded")
+	}
+}
+
+func TestTamperedCiphertext(t *testing.T) {
+	size := 2*ChunkSize + 100
+	plain, sealed, dataKey := encrypted(t, size)
+	lastChunk := 2 * (ChunkSize + overhead)
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		size   int64
+	}{
+		{"flipped byte", func() []byte {
+			tampered := bytes.Clone(sealed)
+			tampered[ChunkSize+overhead+3] ^= 1
+			return tampered
+		}(), int64(size)},
+		{"truncated chunk", sealed[:len(sealed)-1], int64(size)},
+		// Dropping the last chunk and claiming a shorter object leaves chunk 1
+		// read as the final chunk, which it wasn't sealed as.
+		{"dropped final chunk", sealed[:lastChunk], 2 * ChunkSize},
+		{"swapped chunks", func() []byte {
+			swapped := bytes.Clone(sealed)
+			first := swapped[:ChunkSize+overhead]
+			second := swapped[ChunkSize+overhead : lastChunk]
+			tmp := bytes.Clone(first)
+			copy(first, second)
+			copy(second, tmp)
+			return swapped
+		}(), int64(size)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opens int
+			r, err := NewReader(opener(tt.sealed, &opens), dataKey, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err == nil {
+				t.Fatalf("read %d bytes without an error", len(got))
+			}
+			if len(got) > 0 && !bytes.Equal(got, plain[:len(got)]) {
+				t.Error("returned bytes that aren't the plaintext before failing")
+			}
+		})
+	}
+
+	wrongKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opens int
+	r, err := NewReader(opener(sealed, &opens), wrongKey, int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil || !strings.Contains(err.Error(), "decrypt chunk 0") {
+		t.Errorf("reading with the wrong data key = %v, want chunk 0 to fail", err)
+	}
+}
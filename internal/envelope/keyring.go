@@ -0,0 +1,116 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of master and data keys, which are AES-256 keys.
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Keyring holds the master keys that wrap per-object data keys. New data
+// keys are wrapped with the active key; the others are kept so objects
+// wrapped before a rotation can still be read.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+// ParseKeyring reads keys written as "id:base64key,id:base64key". activeID
+// must name one of them.
+func ParseKeyring(value, activeID string) (*Keyring, error) {
+	keyring := &Keyring{activeID: activeID, keys: map[string][]byte{}}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found || id == "" {
+			return nil, fmt.Errorf("key entry %q must look like id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s isn't valid base64: %w", id, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %s is %d bytes, expected %d", id, len(key), KeySize)
+		}
+		if _, ok := keyring.keys[id]; ok {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		keyring.keys[id] = key
+	}
+	if _, ok := keyring.keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q isn't in the keyring", activeID)
+	}
+	return keyring, nil
+}
+
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+// NewDataKey returns a fresh random data key for one object.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("couldn't generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// Wrap encrypts a data key with the active master key and returns the ID of
+// that key along with the wrapped data key as base64.
+func (k *Keyring) Wrap(dataKey []byte) (string, string, error) {
+	aead, err := newGCM(k.keys[k.activeID])
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("couldn't generate nonce: %w", err)
+	}
+	// The key ID is authenticated so a wrapped key can't be passed off as
+	// belonging to another master key.
+	sealed := aead.Seal(nonce, nonce, dataKey, []byte(k.activeID))
+	return k.activeID, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) Unwrap(keyID, wrapped string) ([]byte, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("wrapped data key isn't valid base64: %w", err)
+	}
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	dataKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't unwrap data key with master key %q: %w", keyID, err)
+	}
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
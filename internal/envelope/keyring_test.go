@@ -0,0 +1,81 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, KeySize))
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		activeID string
+		wantErr  string
+	}{
+		{"valid", "old:" + testKey(1) + ", new:" + testKey(2) + ",", "new", ""},
+		{"missing separator", testKey(1), "old", "must look like id:base64key"},
+		{"empty id", ":" + testKey(1), "old", "must look like id:base64key"},
+		{"bad base64", "old:not base64!", "old", "isn't valid base64"},
+		{"short key", "old:" + base64.StdEncoding.EncodeToString([]byte("short")), "old", "is 5 bytes"},
+		{"duplicate id", "old:" + testKey(1) + ",old:" + testKey(2), "old", "listed twice"},
+		{"unknown active key", "old:" + testKey(1), "new", `active key "new" isn't in the keyring`},
+		{"empty", "", "old", `active key "old" isn't in the keyring`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring, err := ParseKeyring(tt.value, tt.activeID)
+			if tt.wantErr == "" {
+				if err != nil || keyring.ActiveID() != tt.activeID {
+					t.Fatalf("ParseKeyring = %v, %v, want active key %s", keyring, err, tt.activeID)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseKeyring = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	old, err := ParseKeyring("old:"+testKey(1), "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ParseKeyring("old:"+testKey(1)+",new:"+testKey(2), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, wrapped, err := old.Wrap(dataKey)
+	if err != nil || keyID != "old" {
+		t.Fatalf("Wrap = %s, %v, want the active key old", keyID, err)
+	}
+	// Keys wrapped before a rotation still unwrap.
+	if got, err := rotated.Unwrap(keyID, wrapped); err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("Unwrap after a rotation = %v, want the data key", err)
+	}
+	if _, err := rotated.Unwrap("new", wrapped); err == nil {
+		t.Error("Unwrap under another key ID succeeded")
+	}
+	if _, err := old.Unwrap("missing", wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Unwrap with an unknown key ID = %v, want ErrUnknownKey", err)
+	}
+	if _, err := old.Unwrap(keyID, "not base64!"); err == nil {
+		t.Error("Unwrap of invalid base64 succeeded")
+	}
+	if _, err := old.Unwrap(keyID, base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("Unwrap of a short wrapped key succeeded")
+	}
+}
@@ -6,26 +6,9 @@ import (
 	"net/http"
 	"os"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
-type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
-	s3Client		 *s3.Client
-}
-
 type thumbnail struct {
 	data      []byte
 	mediaType string
@@ -34,110 +17,82 @@ type thumbnail struct {
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
-	}
-
-	db, err := database.NewClient(pathToDB)
-	if err != nil {
-		log.Fatalf("Couldn't connect to database: %v", err)
-	}
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
-	}
-
-	platform := os.Getenv("PLATFORM")
-	if platform == "" {
-		log.Fatal("PLATFORM environment variable is not set")
-	}
-
-	filepathRoot := os.Getenv("FILEPATH_ROOT")
-	if filepathRoot == "" {
-		log.Fatal("FILEPATH_ROOT environment variable is not set")
-	}
-
-	assetsRoot := os.Getenv("ASSETS_ROOT")
-	if assetsRoot == "" {
-		log.Fatal("ASSETS_ROOT environment variable is not set")
-	}
+	cfg, db := loadConfig()
 
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
+	if len(os.Args) > 1 {
+		err := runCommand(&cfg, db, os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
-	}
-
-	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	err := cfg.prepareDatabase(context.Background(), db)
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
 	}
 
-	awsCfg, err := config.LoadDefaultConfig(
-		context.Background(),
-		config.WithRegion(s3Region),
-	)
+	err = cfg.ensureAssetsDir()
 	if err != nil {
-		log.Fatalf("Couldn't load AWS config: %v", err)
+		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
-	s3Client := s3.NewFromConfig(awsCfg)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("PORT environment variable is not set")
-	}
+	go cfg.cdnInvalidations.Run(context.Background())
+	go cfg.runTrashPurge(context.Background())
 
-	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
-		s3Client:         s3Client,
-	}
+	mux := cfg.routes()
 
-	err = cfg.ensureAssetsDir()
-	if err != nil {
-		log.Fatalf("Couldn't create assets directory: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + cfg.port,
+		Handler: mux,
 	}
 
+	log.Printf("Serving on: http://localhost:%s/app/\n", cfg.port)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// routes registers every handler on a new mux.
+func (cfg *apiConfig) routes() *http.ServeMux {
 	mux := http.NewServeMux()
-	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(cfg.filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	mux.Handle("GET /assets/{path...}", cacheMiddleware(cacheImmutable, cfg.handlerAssets))
+
+	// Streams are revalidated against the object's ETag, which the proxy
+	// passes through.
+	streamCache := cachePolicy{cacheControl: "public, no-cache"}
+	if cfg.signsVideoURLs() {
+		streamCache.cacheControl = "private, no-cache"
+	}
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.Handle("GET /api/users/me/usage", cacheMiddleware(cacheNoStore, cfg.handlerUserUsage))
+	mux.HandleFunc("PUT /api/users/me/video_version_limit", cfg.handlerUserVideoVersionLimit)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.Handle("GET /api/videos", cacheMiddleware(cacheNoStore, cfg.handlerVideosRetrieve))
+	mux.Handle("GET /api/videos/search", cacheMiddleware(cacheNoStore, cfg.handlerVideosSearch))
+	mux.Handle("GET /api/videos/{videoID}", cacheMiddleware(cacheRevalidate, cfg.handlerVideoGet))
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore)
+	mux.Handle("GET /api/trash", cacheMiddleware(cacheNoStore, cfg.handlerTrashList))
+	mux.Handle("GET /api/videos/{videoID}/stream", cacheMiddleware(streamCache, cfg.handlerVideoStream))
+	mux.HandleFunc("POST /api/videos/{videoID}/playback_cookies", cfg.handlerVideoPlaybackCookies)
+	mux.Handle("GET /api/videos/{videoID}/versions", cacheMiddleware(cacheNoStore, cfg.handlerVideoVersionsList))
+	mux.HandleFunc("POST /api/videos/{videoID}/versions/{version}/rollback", cfg.handlerVideoVersionRollback)
+	mux.HandleFunc("PUT /api/videos/{videoID}/tags", cfg.handlerVideoTagsUpdate)
+	mux.Handle("GET /api/tags", cacheMiddleware(cacheNoStore, cfg.handlerTagsList))
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.Handle("GET /admin/invalidations", cacheMiddleware(cacheNoStore, cfg.handlerInvalidationsList))
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
-	}
-
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	return mux
 }
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	testBucket = "tubely-test"
+	testCDN    = "https://cdn.example.com"
+)
+
+// testServer runs the routes from main against a MemoryStore and a fake
+// bucket.
+type testServer struct {
+	t       *testing.T
+	cfg     *apiConfig
+	store   *database.MemoryStore
+	bucket  *fakeBucket
+	handler http.Handler
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	bucket := newFakeBucket(t)
+	s3Client, err := newS3Client(aws.Config{Region: "us-east-1"}, s3ClientOptions{
+		endpoint:        bucket.server.URL,
+		usePathStyle:    true,
+		accessKeyID:     "test",
+		secretAccessKey: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	videoKeyTemplate, err := parseKeyTemplate(defaultVideoKeyTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnailKeyTemplate, err := parseKeyTemplate(defaultThumbnailKeyTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := database.NewMemoryStore()
+	cfg := &apiConfig{
+		store:            store,
+		jwtSecret:        "test-secret",
+		platform:         "dev",
+		filepathRoot:     t.TempDir(),
+		assetsRoot:       t.TempDir(),
+		s3Bucket:         testBucket,
+		s3Region:         "us-east-1",
+		s3CfDistribution: testCDN,
+		publicURLs: publicURLs{
+			video:     testCDN,
+			thumbnail: testCDN,
+			assets:    "http://localhost:8091/assets",
+		},
+		port:                 "8091",
+		s3Client:             s3Client,
+		s3PresignClient:      s3.NewPresignClient(s3Client),
+		s3PresignExpiry:      15 * time.Minute,
+		cfSignedExpiry:       time.Hour,
+		cdnInvalidations:     cdn.NewBatcher(cdn.NewFakeInvalidator(), time.Hour),
+		videoKeyTemplate:     videoKeyTemplate,
+		thumbnailKeyTemplate: thumbnailKeyTemplate,
+		videoVersionLimit:    5,
+		quotaBytes:           5 << 30,
+		quotaVideos:          100,
+		trashRetention:       30 * 24 * time.Hour,
+		trashPurgeInterval:   time.Hour,
+	}
+	return &testServer{t: t, cfg: cfg, store: store, bucket: bucket, handler: cfg.routes()}
+}
+
+// do sends a request with an optional bearer token. A body that isn't a
+// string or byte slice is sent as JSON.
+func (s *testServer) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return s.serve(req)
+}
+
+func (s *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// signUp creates a user and logs them in, returning their access token.
+func (s *testServer) signUp(email string) (string, uuid.UUID) {
+	s.t.Helper()
+
+	credentials := map[string]string{"email": email, "password": "hunter2"}
+	rec := s.do("POST", "/api/users", "", credentials)
+	expectStatus(s.t, rec, http.StatusCreated)
+	rec = s.do("POST", "/api/login", "", credentials)
+	expectStatus(s.t, rec, http.StatusOK)
+	login := decodeJSON[struct {
+		ID    uuid.UUID `json:"id"`
+		Token string    `json:"token"`
+	}](s.t, rec)
+	return login.Token, login.ID
+}
+
+func (s *testServer) createVideo(token, title string) database.Video {
+	s.t.Helper()
+
+	rec := s.do("POST", "/api/videos", token, map[string]any{"title": title, "description": "About " + title})
+	expectStatus(s.t, rec, http.StatusCreated)
+	return decodeJSON[database.Video](s.t, rec)
+}
+
+// patchVideo applies a merge patch to the video, as of ifMatch.
+func (s *testServer) patchVideo(token, videoID, ifMatch string, patch any) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest("PATCH", "/api/videos/"+videoID, bytes.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", ifMatch)
+	return s.serve(req)
+}
+
+// setVideoFile points the video at an object in the bucket without going
+// through an upload.
+func (s *testServer) setVideoFile(videoID uuid.UUID, key string, data []byte) {
+	s.t.Helper()
+
+	ctx := context.Background()
+	video, err := s.store.GetVideo(ctx, videoID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.bucket.put(key, "video/mp4", data)
+	video.VideoURL = &key
+	if err := s.store.UpdateVideo(ctx, video); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// upload sends data as the file field of a multipart form.
+func (s *testServer) upload(path, token, field, contentType string, data []byte, header http.Header) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	partHeader := textproto.MIMEHeader{}
+	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename="upload"`, field))
+	partHeader.Set("Content-Type", contentType)
+	part, err := form.CreatePart(partHeader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		s.t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", path, &body)
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return s.serve(req)
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body)
+	}
+}
+
+func decodeJSON[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("couldn't decode %q: %v", rec.Body, err)
+	}
+	return v
+}
+
+// installFakeMediaTools puts ffmpeg and ffprobe stand-ins on PATH: ffmpeg
+// copies its input to the output file, failing unless asked for faststart,
+// and ffprobe reports a 1920x1080 video.
+func installFakeMediaTools(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	tools := map[string]string{
+		"ffmpeg":  "#!/bin/sh\ncase \"$*\" in *faststart*) ;; *) exit 1 ;; esac\nfor out; do :; done\nexec cp \"$2\" \"$out\"\n",
+		"ffprobe": "#!/bin/sh\necho '{\"streams\":[{\"width\":1920,\"height\":1080}],\"format\":{\"duration\":\"12.5\"}}'\n",
+	}
+	for name, script := range tools {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// fakeBucket answers the path-style GetObject, PutObject and DeleteObject
+// requests the handlers make, for a single bucket.
+type fakeBucket struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	contentType string
+	data        []byte
+}
+
+func newFakeBucket(t *testing.T) *fakeBucket {
+	b := &fakeBucket{objects: map[string]fakeObject{}}
+	b.server = httptest.NewServer(http.HandlerFunc(b.serveHTTP))
+	t.Cleanup(b.server.Close)
+	return b
+}
+
+func (b *fakeBucket) put(key, contentType string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = fakeObject{contentType: contentType, data: data}
+}
+
+func (b *fakeBucket) get(key string) (fakeObject, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	obj, ok := b.objects[key]
+	return obj, ok
+}
+
+func (b *fakeBucket) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.objects)
+}
+
+func (b *fakeBucket) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		http.Error(w, "unknown bucket", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b.put(key, r.Header.Get("Content-Type"), data)
+		w.Header().Set("ETag", fakeETag(data))
+	case http.MethodGet, http.MethodHead:
+		obj, ok := b.get(key)
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("ETag", fakeETag(obj.data))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(obj.data))
+	case http.MethodDelete:
+		b.mu.Lock()
+		delete(b.objects, key)
+		b.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func fakeETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func TestAppFileServer(t *testing.T) {
+	s := newTestServer(t)
+	if err := os.WriteFile(filepath.Join(s.cfg.filepathRoot, "index.html"), []byte("<h1>Tubely</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do("GET", "/app/", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != "<h1>Tubely</h1>" {
+		t.Errorf("body = %q, want index.html", rec.Body)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// handlerAssets serves files under assetsRoot. http.ServeContent answers
+// Range, If-Range and the conditional headers against the ETag and
+// modification time of the file.
+func (cfg *apiConfig) handlerAssets(w http.ResponseWriter, r *http.Request) {
+	file, err := http.Dir(cfg.assetsRoot).Open("/" + r.PathValue("path"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", localFileETag(info))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// localFileETag derives a validator from size and modification time, like
+// most static file servers, so serving a file doesn't mean hashing it.
+func localFileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// handlerVideoStream plays a video's current object through this server
+// instead of the CDN, passing ranged and conditional requests on to the
+// bucket so players can seek. Encrypted videos are decrypted on the way.
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", nil)
+		return
+	}
+	if cfg.restrictsVideo(video) && !canViewVideo(cfg.viewerID(r), video) && !cfg.validStreamSignature(r, videoID) {
+		respondWithError(w, http.StatusForbidden, "You can't view this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no uploaded file", nil)
+		return
+	}
+	key, ok := cfg.objectKeyFromStored(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Video isn't stored in the bucket", nil)
+		return
+	}
+
+	if video.EncryptionKeyID != nil {
+		cfg.serveDecryptedObject(w, r, key)
+		return
+	}
+	cfg.proxyObject(w, r, key)
+}
+
+// proxyObject streams an object from the bucket. S3 evaluates Range and the
+// If-Match/If-None-Match/If-Modified-Since/If-Unmodified-Since preconditions
+// itself. It has no If-Range, so a ranged request with If-Range is sent with
+// the validator as a precondition and retried without the range when the
+// object has changed, which is what If-Range asks for.
+func (cfg *apiConfig) proxyObject(w http.ResponseWriter, r *http.Request, key string) {
+	input := &s3.GetObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	}
+	if value := r.Header.Get("If-Match"); value != "" {
+		input.IfMatch = &value
+	}
+	if value := r.Header.Get("If-None-Match"); value != "" {
+		input.IfNoneMatch = &value
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && input.IfNoneMatch == nil {
+		input.IfModifiedSince = &t
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && input.IfMatch == nil {
+		input.IfUnmodifiedSince = &t
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	ifRange := r.Header.Get("If-Range")
+	if rangeHeader != "" {
+		input.Range = &rangeHeader
+		if ifRange != "" && input.IfMatch == nil && input.IfUnmodifiedSince == nil {
+			if t, err := http.ParseTime(ifRange); err == nil {
+				input.IfUnmodifiedSince = &t
+			} else if !strings.HasPrefix(ifRange, "W/") {
+				input.IfMatch = &ifRange
+			} else {
+				// Weak validators never match If-Range.
+				input.Range = nil
+			}
+		}
+	}
+
+	output, err := cfg.s3Client.GetObject(r.Context(), input)
+	if objectErrorStatus(err) == http.StatusPreconditionFailed && input.Range != nil && ifRange != "" {
+		// The object changed since the client's copy, so it gets all of it.
+		input.Range = nil
+		input.IfMatch = nil
+		input.IfUnmodifiedSince = nil
+		output, err = cfg.s3Client.GetObject(r.Context(), input)
+	}
+	if err != nil {
+		switch status := objectErrorStatus(err); status {
+		case http.StatusNotModified, http.StatusPreconditionFailed:
+			w.WriteHeader(status)
+		case http.StatusNotFound:
+			respondWithError(w, http.StatusNotFound, "Object not found", err)
+		case http.StatusRequestedRangeNotSatisfiable:
+			respondWithError(w, http.StatusRequestedRangeNotSatisfiable, "Range not satisfiable", err)
+		default:
+			respondWithError(w, http.StatusBadGateway, "Couldn't get object", err)
+		}
+		return
+	}
+	defer output.Body.Close()
+
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	if output.ContentType != nil {
+		header.Set("Content-Type", *output.ContentType)
+	}
+	if output.ContentLength != nil {
+		header.Set("Content-Length", strconv.FormatInt(*output.ContentLength, 10))
+	}
+	if output.ETag != nil {
+		header.Set("ETag", *output.ETag)
+	}
+	if output.LastModified != nil {
+		header.Set("Last-Modified", output.LastModified.UTC().Format(http.TimeFormat))
+	}
+	status := http.StatusOK
+	if output.ContentRange != nil {
+		header.Set("Content-Range", *output.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, output.Body); err != nil {
+		log.Printf("Stopped streaming %s: %v", key, err)
+	}
+}
+
+// objectErrorStatus returns the HTTP status S3 answered a failed request
+// with, or 0 when the request didn't get a response.
+func objectErrorStatus(err error) int {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
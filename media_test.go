@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHandlerAssets(t *testing.T) {
+	s := newTestServer(t)
+	if err := os.WriteFile(filepath.Join(s.cfg.assetsRoot, "legacy.png"), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do("GET", "/assets/legacy.png", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != "png" {
+		t.Errorf("body = %q, want the file", rec.Body)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != immutableCacheControl {
+		t.Errorf("Cache-Control = %q, want %q", got, immutableCacheControl)
+	}
+
+	req := httptest.NewRequest("GET", "/assets/legacy.png", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	expectStatus(t, s.serve(req), http.StatusNotModified)
+
+	expectStatus(t, s.do("GET", "/assets/missing.png", "", nil), http.StatusNotFound)
+}
+
+func TestHandlerVideoStream(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String() + "/stream"
+
+	expectStatus(t, s.do("GET", path, "", nil), http.StatusNotFound)
+	s.setVideoFile(video.ID, "landscape-pilot.mp4", []byte("0123456789"))
+
+	rec := s.do("GET", path, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != "0123456789" || rec.Header().Get("Content-Type") != "video/mp4" {
+		t.Errorf("got %q as %s, want the video", rec.Body, rec.Header().Get("Content-Type"))
+	}
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec = s.serve(req)
+	expectStatus(t, rec, http.StatusPartialContent)
+	if rec.Body.String() != "2345" || rec.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("got %q with Content-Range %q, want bytes 2-5", rec.Body, rec.Header().Get("Content-Range"))
+	}
+
+	// A private bucket only streams to the owner.
+	s.cfg.s3PrivateBucket = true
+	expectStatus(t, s.do("GET", path, "", nil), http.StatusForbidden)
+	expectStatus(t, s.do("GET", path, otherToken, nil), http.StatusForbidden)
+	expectStatus(t, s.do("GET", path, token, nil), http.StatusOK)
+
+	expectStatus(t, s.do("GET", "/api/videos/"+uuid.NewString()+"/stream", "", nil), http.StatusNotFound)
+}
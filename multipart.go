@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+)
+
+var errUploadLimit = errors.New("upload limit exceeded")
+
+// nextFormPart advances reader to the part for the named form field without
+// buffering any of the parts before it.
+func nextFormPart(reader *multipart.Reader, name string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("form field %q not found", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// byteCounter counts the bytes written through it and fails once more than
+// limit bytes have been seen. A limit of zero or less disables the check.
+type byteCounter struct {
+	n     int64
+	limit int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	if c.limit > 0 && c.n > c.limit {
+		return 0, fmt.Errorf("%w: received more than %d bytes", errUploadLimit, c.limit)
+	}
+	return len(p), nil
+}
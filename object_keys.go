@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultVideoKeyTemplate     = "{variant}-{random}.{ext}"
+	defaultThumbnailKeyTemplate = "{hash}.{ext}"
+)
+
+var keyPlaceholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+var keyPlaceholders = map[string]bool{
+	"{userID}":  true,
+	"{videoID}": true,
+	"{variant}": true,
+	"{ext}":     true,
+	"{random}":  true,
+	"{hash}":    true,
+}
+
+// keyTemplate describes where objects are written, e.g.
+// "users/{userID}/videos/{videoID}/{variant}-{hash}.{ext}".
+type keyTemplate string
+
+type keyVars struct {
+	UserID  uuid.UUID
+	VideoID uuid.UUID
+	Variant string
+	Ext     string
+	Random  string
+	Hash    string
+}
+
+// parseKeyTemplate rejects unknown placeholders and templates that would
+// write every upload of a video to the same key, which would overwrite the
+// objects earlier versions and other videos still point at.
+func parseKeyTemplate(value string) (keyTemplate, error) {
+	for _, placeholder := range keyPlaceholderRegex.FindAllString(value, -1) {
+		if !keyPlaceholders[placeholder] {
+			return "", fmt.Errorf("unknown placeholder %s in key template %q", placeholder, value)
+		}
+	}
+	if !strings.Contains(value, "{random}") && !strings.Contains(value, "{hash}") {
+		return "", fmt.Errorf("key template %q must contain {random} or {hash}", value)
+	}
+	if strings.HasPrefix(value, "/") || strings.Contains(value, "..") {
+		return "", fmt.Errorf("key template %q must be a relative path", value)
+	}
+	return keyTemplate(value), nil
+}
+
+// uses reports whether rendering needs the given variable, e.g. "{hash}".
+func (t keyTemplate) uses(placeholder string) bool {
+	return strings.Contains(string(t), placeholder)
+}
+
+// dedupOwner is the owner storeObject deduplicates an upload by userID
+// against. Keys naming the user or video must not be handed to other users,
+// so those uploads only share objects with the same user's.
+func (t keyTemplate) dedupOwner(userID uuid.UUID) *uuid.UUID {
+	if t.uses("{userID}") || t.uses("{videoID}") {
+		return &userID
+	}
+	return nil
+}
+
+func (t keyTemplate) render(vars keyVars) (string, error) {
+	if vars.Random == "" && t.uses("{random}") {
+		random, err := randomKeyPart()
+		if err != nil {
+			return "", err
+		}
+		vars.Random = random
+	}
+	if vars.Hash == "" && t.uses("{hash}") {
+		return "", fmt.Errorf("key template %q needs the content hash", t)
+	}
+
+	replacer := strings.NewReplacer(
+		"{userID}", vars.UserID.String(),
+		"{videoID}", vars.VideoID.String(),
+		"{variant}", vars.Variant,
+		"{ext}", vars.Ext,
+		"{random}", vars.Random,
+		"{hash}", vars.Hash,
+	)
+	return replacer.Replace(string(t)), nil
+}
+
+var keyPlaceholderPatterns = map[string]string{
+	"{userID}":  `[0-9a-f-]{36}`,
+	"{videoID}": `[0-9a-f-]{36}`,
+	"{variant}": `[a-z]+`,
+	"{ext}":     `[A-Za-z0-9]+`,
+	"{random}":  `[A-Za-z0-9_-]+`,
+	"{hash}":    `[0-9a-f]{64}`,
+}
+
+// matches reports whether key already follows the template, so migrations
+// can skip objects that were written with the current layout.
+func (t keyTemplate) matches(key string) bool {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	template := string(t)
+	last := 0
+	for _, loc := range keyPlaceholderRegex.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		pattern.WriteString(keyPlaceholderPatterns[template[loc[0]:loc[1]]])
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+	matched, err := regexp.MatchString(pattern.String(), key)
+	return err == nil && matched
+}
+
+func randomKeyPart() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
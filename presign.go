@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func generatePresignedURL(ctx context.Context, presignClient *s3.PresignClient, bucket, key string, expireTime time.Duration) (string, error) {
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(expireTime))
+	if err != nil {
+		return "", fmt.Errorf("couldn't presign GetObject for %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// dbVideoToSignedVideo turns a video's stored object keys into the URLs
+// handed to clients: CloudFront signed URLs when a key pair is configured,
+// S3 presigned URLs for private buckets, and plain public URLs otherwise.
+func (cfg *apiConfig) dbVideoToSignedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	var err error
+	if video.EncryptionKeyID != nil && video.VideoURL != nil {
+		// Encrypted objects are only readable through the decrypting
+		// stream endpoint.
+		streamURL := cfg.signedStreamURL(video.ID)
+		video.VideoURL = &streamURL
+	} else {
+		video.VideoURL, err = cfg.publicURLForStored(ctx, video.VideoURL, cfg.publicURLs.video)
+		if err != nil {
+			return database.Video{}, err
+		}
+	}
+	video.ThumbnailURL, err = cfg.publicURLForStored(ctx, video.ThumbnailURL, cfg.publicURLs.thumbnail)
+	if err != nil {
+		return database.Video{}, err
+	}
+	return video, nil
+}
+
+func (cfg *apiConfig) publicURLForStored(ctx context.Context, stored *string, baseURL string) (*string, error) {
+	if stored == nil {
+		return nil, nil
+	}
+	key, ok := cfg.objectKeyFromStored(*stored)
+	if !ok {
+		if localKey, ok := localThumbnailKeyFromURL(*stored); ok {
+			assetURL := joinPublicURL(cfg.publicURLs.assets, localKey)
+			return &assetURL, nil
+		}
+		return stored, nil
+	}
+
+	var publicURL string
+	var err error
+	switch {
+	case cfg.cfURLSigner != nil:
+		publicURL, err = cfg.signCloudFrontURL(baseURL, key)
+	case cfg.s3PrivateBucket:
+		publicURL, err = generatePresignedURL(ctx, cfg.s3PresignClient, cfg.s3Bucket, key, cfg.s3PresignExpiry)
+	default:
+		publicURL = joinPublicURL(baseURL, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &publicURL, nil
+}
+
+// signsVideoURLs reports whether video URLs are access controlled, in which
+// case they are only handed to users allowed to view the video.
+func (cfg *apiConfig) signsVideoURLs() bool {
+	return cfg.s3PrivateBucket || cfg.cfURLSigner != nil
+}
+
+// signedURLLifetime is how long the URLs dbVideoToSignedVideo gives the
+// video stay valid, or zero if they don't expire.
+func (cfg *apiConfig) signedURLLifetime(video database.Video) time.Duration {
+	var lifetime time.Duration
+	switch {
+	case cfg.cfURLSigner != nil:
+		lifetime = cfg.cfSignedExpiry
+	case cfg.s3PrivateBucket:
+		lifetime = cfg.s3PresignExpiry
+	}
+	if video.EncryptionKeyID != nil && video.VideoURL != nil && (lifetime == 0 || cfg.s3PresignExpiry < lifetime) {
+		// The stream URL is signed for s3PresignExpiry.
+		lifetime = cfg.s3PresignExpiry
+	}
+	return lifetime
+}
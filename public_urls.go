@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// publicURLs holds the base URLs clients reach each class of asset through.
+// The videos table stores object keys, and links are built from these bases
+// when a response is written, so moving to another domain or putting a
+// proxy in front doesn't need a data migration.
+type publicURLs struct {
+	video     string
+	thumbnail string
+	// assets serves thumbnails that still live under assetsRoot.
+	assets string
+}
+
+// parsePublicBaseURL accepts an absolute http(s) URL, optionally with a path,
+// and returns it without a trailing slash. A bare host such as a CloudFront
+// domain is taken to mean https.
+func parsePublicBaseURL(value string) (string, error) {
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("base URL %q must use http or https", value)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("base URL %q has no host", value)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("base URL %q can't have a query or fragment", value)
+	}
+	return strings.TrimSuffix(parsed.String(), "/"), nil
+}
+
+// joinPublicURL appends an object key to a base URL, escaping each segment
+// of the key.
+func joinPublicURL(base, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return base + "/" + strings.Join(segments, "/")
+}
+
+// objectKeyFromStored recovers the object key from a stored video_url or
+// thumbnail_url. New rows hold the bare key; rows written before that hold
+// a URL on the CloudFront distribution or one of the public base URLs.
+// Thumbnails still served from assetsRoot are not objects.
+func (cfg *apiConfig) objectKeyFromStored(value string) (string, bool) {
+	if cfg.isStoredObjectKey(value) {
+		return value, true
+	}
+	prefixes := []string{
+		cfg.s3CfDistribution + "/",
+		cfg.cloudFrontBaseURL() + "/",
+		cfg.publicURLs.video + "/",
+		cfg.publicURLs.thumbnail + "/",
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			key := strings.TrimPrefix(value, prefix)
+			if unescaped, err := url.PathUnescape(key); err == nil {
+				key = unescaped
+			}
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// isStoredObjectKey reports whether a stored video_url or thumbnail_url holds
+// a bare object key rather than a full URL.
+func (cfg *apiConfig) isStoredObjectKey(value string) bool {
+	return !strings.Contains(value, "://") && !strings.HasPrefix(value, cfg.s3CfDistribution+"/")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// quotaFor applies the deployment defaults to a user's usage row. Zero means
+// unlimited.
+func (cfg *apiConfig) quotaFor(usage database.UserUsage) (int64, int) {
+	quotaBytes := cfg.quotaBytes
+	if usage.QuotaBytes != nil {
+		quotaBytes = *usage.QuotaBytes
+	}
+	quotaVideos := cfg.quotaVideos
+	if usage.QuotaVideos != nil {
+		quotaVideos = *usage.QuotaVideos
+	}
+	return quotaBytes, quotaVideos
+}
+
+// reserveStorage counts bytes against the user's storage quota. The returned
+// message explains the rejection when the quota would be exceeded.
+func (cfg *apiConfig) reserveStorage(ctx context.Context, db database.UsageStore, userID uuid.UUID, bytes int64) (bool, string, error) {
+	usage, err := db.GetUserUsage(ctx, userID)
+	if err != nil {
+		return false, "", err
+	}
+	quotaBytes, _ := cfg.quotaFor(usage)
+
+	ok, err := db.ReserveUserStorage(ctx, userID, bytes, quotaBytes)
+	if err != nil || ok {
+		return ok, "", err
+	}
+	return false, fmt.Sprintf(
+		"Upload of %d bytes would exceed your storage quota: %d of %d bytes used",
+		bytes, usage.StorageUsedBytes, quotaBytes,
+	), nil
+}
+
+// reserveVideo counts a new video against the user's video quota. Pass a
+// transaction to have the reservation undone with it.
+func (cfg *apiConfig) reserveVideo(ctx context.Context, db database.UsageStore, userID uuid.UUID) (bool, string, error) {
+	usage, err := db.GetUserUsage(ctx, userID)
+	if err != nil {
+		return false, "", err
+	}
+	_, quotaVideos := cfg.quotaFor(usage)
+
+	ok, err := db.ReserveUserVideo(ctx, userID, quotaVideos)
+	if err != nil || ok {
+		return ok, "", err
+	}
+	return false, fmt.Sprintf(
+		"You have reached your quota of %d videos, delete one before creating another",
+		quotaVideos,
+	), nil
+}
+
+func (cfg *apiConfig) handlerUserUsage(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		StorageUsedBytes int64  `json:"storage_used_bytes"`
+		QuotaBytes       *int64 `json:"quota_bytes"`
+		VideoCount       int    `json:"video_count"`
+		QuotaVideos      *int   `json:"quota_videos"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	usage, err := cfg.store.GetUserUsage(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+	if usage.UserID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user", nil)
+		return
+	}
+
+	quotaBytes, quotaVideos := cfg.quotaFor(usage)
+	resp := response{
+		StorageUsedBytes: usage.StorageUsedBytes,
+		VideoCount:       usage.VideoCount,
+	}
+	if quotaBytes > 0 {
+		resp.QuotaBytes = &quotaBytes
+	}
+	if quotaVideos > 0 {
+		resp.QuotaVideos = &quotaVideos
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestHandlerUserUsage(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	s.createVideo(token, "Pilot")
+
+	rec := s.do("GET", "/api/users/me/usage", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	usage := decodeJSON[struct {
+		StorageUsedBytes int64  `json:"storage_used_bytes"`
+		QuotaBytes       *int64 `json:"quota_bytes"`
+		VideoCount       int    `json:"video_count"`
+		QuotaVideos      *int   `json:"quota_videos"`
+	}](t, rec)
+	if usage.VideoCount != 1 || usage.StorageUsedBytes != 0 {
+		t.Errorf("usage = %+v, want one video and no storage", usage)
+	}
+	if usage.QuotaVideos == nil || *usage.QuotaVideos != s.cfg.quotaVideos {
+		t.Errorf("quota_videos = %v, want %d", usage.QuotaVideos, s.cfg.quotaVideos)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+
+	expectStatus(t, s.do("GET", "/api/users/me/usage", "", nil), http.StatusUnauthorized)
+}
+
+func TestThumbnailQuota(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.quotaBytes = 25
+	token, userID := s.signUp("walt@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/thumbnail_upload/" + video.ID.String()
+	usedBytes := func() int64 {
+		t.Helper()
+		usage, err := s.store.GetUserUsage(context.Background(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return usage.StorageUsedBytes
+	}
+
+	expectStatus(t, s.upload(path, token, "thumbnail", "image/png", []byte("twelve bytes"), nil), http.StatusOK)
+	if used := usedBytes(); used != 12 {
+		t.Errorf("storage_used_bytes = %d, want the thumbnail's 12", used)
+	}
+	// Replacing the thumbnail gives back the space of the old one, once the
+	// new one is stored.
+	expectStatus(t, s.upload(path, token, "thumbnail", "image/png", []byte("ten bytes!"), nil), http.StatusOK)
+	if used := usedBytes(); used != 10 {
+		t.Errorf("storage_used_bytes after a replacement = %d, want 10", used)
+	}
+	expectStatus(t, s.upload(path, token, "thumbnail", "image/png", []byte("sixteen bytes!!!"), nil), http.StatusRequestEntityTooLarge)
+	if used := usedBytes(); used != 10 {
+		t.Errorf("storage_used_bytes after a rejected upload = %d, want 10", used)
+	}
+
+	// Purging the video gives back the space of its thumbnail.
+	expectStatus(t, s.do("DELETE", "/api/videos/"+video.ID.String(), token, nil), http.StatusNoContent)
+	s.cfg.trashRetention = 0
+	if purged, err := s.cfg.purgeTrash(context.Background()); err != nil || purged != 1 {
+		t.Fatalf("purgeTrash = %d, %v, want the video purged", purged, err)
+	}
+	if used := usedBytes(); used != 0 {
+		t.Errorf("storage_used_bytes after purging the video = %d, want 0", used)
+	}
+}
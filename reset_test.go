@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandlerReset(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	s.createVideo(token, "Pilot")
+
+	s.cfg.platform = "prod"
+	expectStatus(t, s.do("POST", "/admin/reset", "", nil), http.StatusForbidden)
+
+	s.cfg.platform = "dev"
+	expectStatus(t, s.do("POST", "/admin/reset", "", nil), http.StatusOK)
+	rec := s.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "hunter2"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
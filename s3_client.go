@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3ClientOptions point the S3 client at an S3-compatible store such as
+// MinIO or Ceph instead of AWS. The zero value talks to AWS with the default
+// credential chain.
+type s3ClientOptions struct {
+	endpoint           string
+	usePathStyle       bool
+	accessKeyID        string
+	secretAccessKey    string
+	sessionToken       string
+	caCertPath         string
+	insecureSkipVerify bool
+}
+
+func newS3Client(awsCfg aws.Config, opts s3ClientOptions) (*s3.Client, error) {
+	var httpClient *awshttp.BuildableClient
+	if opts.caCertPath != "" || opts.insecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: opts.insecureSkipVerify}
+		if opts.caCertPath != "" {
+			pem, err := os.ReadFile(opts.caCertPath)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read CA certificate: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", opts.caCertPath)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		httpClient = awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.TLSClientConfig = tlsConfig
+		})
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if opts.endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.endpoint)
+			// Many S3-compatible stores don't accept the streaming checksum
+			// trailers the SDK adds by default. Uploads still send the
+			// SHA-256 we compute ourselves.
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		o.UsePathStyle = opts.usePathStyle
+		if opts.accessKeyID != "" {
+			o.Credentials = credentials.NewStaticCredentialsProvider(opts.accessKeyID, opts.secretAccessKey, opts.sessionToken)
+		}
+		if httpClient != nil {
+			o.HTTPClient = httpClient
+		}
+	}), nil
+}
+
+// probeBucket checks that the bucket exists and the credentials can reach
+// it, so a misconfigured store fails at startup instead of on the first
+// upload.
+func probeBucket(ctx context.Context, client *s3.Client, bucket, endpoint string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if endpoint == "" {
+		endpoint = "AWS"
+	}
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &bucket})
+	if err == nil {
+		return nil
+	}
+	switch objectErrorStatus(err) {
+	case http.StatusNotFound:
+		return fmt.Errorf("bucket %q doesn't exist on %s", bucket, endpoint)
+	case http.StatusForbidden:
+		return fmt.Errorf("access to bucket %q on %s was denied, check the credentials and bucket policy", bucket, endpoint)
+	case http.StatusMovedPermanently:
+		return fmt.Errorf("bucket %q on %s is in another region than S3_REGION", bucket, endpoint)
+	}
+	return fmt.Errorf("couldn't reach bucket %q on %s: %w", bucket, endpoint, err)
+}
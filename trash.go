@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const trashPurgeBatchSize = 100
+
+// handlerTrashList returns the caller's deleted videos, most recently deleted
+// first, with when each will be purged. Videos in the trash still count
+// towards the caller's quota.
+func (cfg *apiConfig) handlerTrashList(w http.ResponseWriter, r *http.Request) {
+	type trashedVideo struct {
+		database.Video
+		PurgeAt time.Time `json:"purge_at"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	videos, err := cfg.store.ListTrashedVideos(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trash", err)
+		return
+	}
+
+	trash := make([]trashedVideo, 0, len(videos))
+	for _, video := range videos {
+		video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+			return
+		}
+		trash = append(trash, trashedVideo{
+			Video:   video,
+			PurgeAt: video.DeletedAt.Add(cfg.trashRetention),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, trash)
+}
+
+func (cfg *apiConfig) handlerVideoRestore(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	restored, err := cfg.store.RestoreVideo(r.Context(), videoID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	if !restored {
+		respondWithError(w, http.StatusNotFound, "Video isn't in your trash", nil)
+		return
+	}
+
+	video, err := cfg.store.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// runTrashPurge purges expired videos from the trash now and then every
+// trashPurgeInterval until ctx is cancelled.
+func (cfg *apiConfig) runTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(cfg.trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := cfg.purgeTrash(ctx)
+		if purged > 0 {
+			log.Printf("Purged %d videos from the trash", purged)
+		}
+		if err != nil {
+			log.Printf("Couldn't purge trash: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash permanently deletes every video that has been in the trash for
+// longer than trashRetention, and returns how many it deleted.
+func (cfg *apiConfig) purgeTrash(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-cfg.trashRetention)
+	purged := 0
+	// Purged videos drop out of the listing, so every batch starts over.
+	for {
+		videos, err := cfg.store.ListVideosTrashedBefore(ctx, cutoff, nil, trashPurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for _, video := range videos {
+			err := cfg.purgeVideo(ctx, video)
+			if errors.Is(err, database.ErrVideoNotTrashed) {
+				continue
+			}
+			if err != nil {
+				return purged, fmt.Errorf("couldn't purge video %s: %w", video.ID, err)
+			}
+			purged++
+		}
+		if len(videos) < trashPurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// purgeVideo permanently deletes a video in the trash. The rows and usage
+// counters go in one transaction; objects are only released once it has
+// committed. It returns database.ErrVideoNotTrashed, deleting nothing, if the
+// video was restored or purged in the meantime.
+func (cfg *apiConfig) purgeVideo(ctx context.Context, video database.Video) error {
+	var versions []database.VideoVersion
+	err := cfg.store.WithTx(ctx, func(tx database.Store) error {
+		var err error
+		versions, err = tx.GetVideoVersions(ctx, video.ID)
+		if err != nil {
+			return err
+		}
+		var releasedBytes int64
+		for _, version := range versions {
+			releasedBytes += version.SizeBytes
+		}
+		if video.ThumbnailURL != nil {
+			thumbnail, err := tx.GetContentObjectByKey(ctx, *video.ThumbnailURL)
+			if err != nil {
+				return err
+			}
+			releasedBytes += thumbnail.SizeBytes
+		}
+		if err := tx.DeleteTrashedVideo(ctx, video.ID); err != nil {
+			return err
+		}
+		if err := tx.AddUserStorageUsage(ctx, video.UserID, -releasedBytes); err != nil {
+			return err
+		}
+		return tx.AddUserVideoCount(ctx, video.UserID, -1)
+	})
+	if err != nil {
+		return err
+	}
+
+	if video.VideoURL != nil {
+		if key, ok := cfg.objectKeyFromStored(*video.VideoURL); ok {
+			cfg.invalidateCDN(key)
+		}
+	}
+
+	if video.ThumbnailURL != nil {
+		if key, ok := cfg.objectKeyFromStored(*video.ThumbnailURL); ok {
+			err = cfg.releaseObject(ctx, key)
+			if err != nil {
+				log.Printf("Couldn't release thumbnail %s of video %s: %v", key, video.ID, err)
+			}
+		}
+	}
+
+	for _, version := range versions {
+		err = cfg.releaseObject(ctx, version.ObjectKey)
+		if err != nil {
+			log.Printf("Couldn't release object %s of video %s: %v", version.ObjectKey, video.ID, err)
+		}
+	}
+	return nil
+}
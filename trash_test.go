@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerTrashList(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	video := s.createVideo(token, "Pilot")
+	s.createVideo(token, "Cat's in the Bag")
+	expectStatus(t, s.do("DELETE", "/api/videos/"+video.ID.String(), token, nil), http.StatusNoContent)
+
+	rec := s.do("GET", "/api/trash", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	trash := decodeJSON[[]struct {
+		database.Video
+		PurgeAt time.Time `json:"purge_at"`
+	}](t, rec)
+	if len(trash) != 1 || trash[0].ID != video.ID {
+		t.Fatalf("trash = %+v, want only %s", trash, video.ID)
+	}
+	if want := trash[0].DeletedAt.Add(s.cfg.trashRetention); !trash[0].PurgeAt.Equal(want) {
+		t.Errorf("purge_at = %s, want %s", trash[0].PurgeAt, want)
+	}
+
+	expectStatus(t, s.do("GET", "/api/trash", "", nil), http.StatusUnauthorized)
+}
+
+func TestHandlerVideoRestore(t *testing.T) {
+	s := newTestServer(t)
+	token, _ := s.signUp("walt@example.com")
+	otherToken, _ := s.signUp("jesse@example.com")
+	video := s.createVideo(token, "Pilot")
+	path := "/api/videos/" + video.ID.String()
+
+	expectStatus(t, s.do("POST", path+"/restore", token, nil), http.StatusNotFound)
+	expectStatus(t, s.do("DELETE", path, token, nil), http.StatusNoContent)
+	expectStatus(t, s.do("POST", path+"/restore", otherToken, nil), http.StatusNotFound)
+
+	rec := s.do("POST", path+"/restore", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if restored := decodeJSON[database.Video](t, rec); restored.DeletedAt != nil {
+		t.Errorf("deleted_at = %s, want none", restored.DeletedAt)
+	}
+	expectStatus(t, s.do("GET", path, token, nil), http.StatusOK)
+	expectStatus(t, s.do("POST", "/api/videos/"+uuid.NewString()+"/restore", token, nil), http.StatusNotFound)
+}